@@ -3,11 +3,17 @@ package cgroups
 import (
 	"fmt"
 	"github.com/iverson3/xdocker/cgroups/subsystems"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"syscall"
 )
 
 type CgroupManager struct {
 	// 相对路径，相对的是对应的 hierarchy 的 root path
 	// 所以一个 CgroupManagee 是有可能表示多个 cgroups 的，或者准确来说，和对应的 hierarchy root path 的相对路径一样的多个 cgroups。
+	// cgroup v2 下只有一个 hierarchy，此时 Path 就只对应一个 cgroup
 	Path string
 	Resource *subsystems.ResourceConfig
 }
@@ -20,28 +26,35 @@ func NewCgroupManager(path string) *CgroupManager {
 
 // Set 设置子系统限制
 // 可能会创建多个 cgroups，如果 subsystems 们在不同的 hierarchy 上的话就会这样
+// 各个子系统在用户没有指定对应限制的时候不会做任何事，所以这里出现的错误都是真正的设置失败，需要返回给调用方
 func (c *CgroupManager) Set(res *subsystems.ResourceConfig) error {
+	var errs []string
 	for _, subsystem := range subsystems.SubsystemsInstance {
 		err := subsystem.Set(c.Path, res)
 		if err != nil {
-			// 注意 set 和 addProcess 都不是返回错误，而是发出警告，然后返回 nil。
-			// 因为有些时候用户只指定某一个限制，比如 memory。
-			// 那样的话修改 cpu 等其实会报错的，这是正常的报错，因此我们不 return err 来退出
-			fmt.Println(fmt.Errorf("set resource failed, error: %v", err))
+			errs = append(errs, fmt.Sprintf("%s: %v", subsystem.Name(), err))
 		}
 	}
+	if len(errs) > 0 {
+		return fmt.Errorf("set resource failed, error: %s", strings.Join(errs, "; "))
+	}
+	c.Resource = res
 	return nil
 }
 
 // AddProcess 将当前进程放入各个子系统的cgroup中
 func (c *CgroupManager) AddProcess(pid int) error {
 	//AddProcess 和 Remove 都要在每个 subsystem 上执行一遍。因为这些 subsystem 可能存在于不同的 hierarchies 上。
+	var errs []string
 	for _, subsystem := range subsystems.SubsystemsInstance {
 		err := subsystem.AddProcess(c.Path, pid)
 		if err != nil {
-			fmt.Println(fmt.Errorf("add process failed, error: %v", err))
+			errs = append(errs, fmt.Sprintf("%s: %v", subsystem.Name(), err))
 		}
 	}
+	if len(errs) > 0 {
+		return fmt.Errorf("add process failed, error: %s", strings.Join(errs, "; "))
+	}
 	return nil
 }
 
@@ -56,4 +69,98 @@ func (c *CgroupManager) Destroy() error {
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// GetPidsCurrent 获取cgroup中当前的进程数
+func (c *CgroupManager) GetPidsCurrent() (int64, error) {
+	return (&subsystems.PidsSubsystem{}).Current(c.Path)
+}
+
+// GetStats 获取cgroup的资源使用情况
+func (c *CgroupManager) GetStats() (*subsystems.Stats, error) {
+	return subsystems.GetStats(c.Path)
+}
+
+// NotifyOOM 监听cgroup中的OOM事件
+func (c *CgroupManager) NotifyOOM() (<-chan struct{}, error) {
+	return subsystems.NotifyOOM(c.Path)
+}
+
+// OOMKillCount 获取cgroup中因OOM被杀死的进程数
+func (c *CgroupManager) OOMKillCount() (uint64, error) {
+	return subsystems.OOMKillCount(c.Path)
+}
+
+// Freeze 冻结cgroup中的所有进程
+func (c *CgroupManager) Freeze() error {
+	return (&subsystems.FreezerSubsystem{}).Freeze(c.Path)
+}
+
+// Thaw 解冻cgroup中的所有进程
+func (c *CgroupManager) Thaw() error {
+	return (&subsystems.FreezerSubsystem{}).Thaw(c.Path)
+}
+
+// FreezerState 获取cgroup当前的冻结状态
+func (c *CgroupManager) FreezerState() (string, error) {
+	return (&subsystems.FreezerSubsystem{}).State(c.Path)
+}
+
+// Pids 获取cgroup中的所有进程
+func (c *CgroupManager) Pids() ([]int, error) {
+	return (&subsystems.FreezerSubsystem{}).Pids(c.Path)
+}
+
+// SignalAll 给cgroup中的所有进程发送信号
+// 发送之前先冻结cgroup，避免发送期间有进程fork出新的进程而被漏掉，发送完成后再解冻 (被冻结的进程解冻之后才会处理信号)
+func (c *CgroupManager) SignalAll(sig syscall.Signal) error {
+	pids, err := c.Pids()
+	if err != nil || len(pids) == 0 {
+		return err
+	}
+
+	freezer := &subsystems.FreezerSubsystem{}
+	if err = freezer.Freeze(c.Path); err != nil {
+		// 无法冻结时依然尽力给所有进程发送信号
+		fmt.Println(fmt.Errorf("freeze cgroup failed, error: %v", err))
+	} else {
+		defer freezer.Thaw(c.Path)
+	}
+
+	pids, err = c.Pids()
+	if err != nil {
+		return err
+	}
+	for _, pid := range pids {
+		if err = syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("send signal to process %d failed, error: %v", pid, err)
+		}
+	}
+	return nil
+}
+
+// Children 获取各个子系统中该 cgroup 下的子 cgroup 的名称 (去重)
+func (c *CgroupManager) Children() ([]string, error) {
+	seen := map[string]bool{}
+	var children []string
+	for _, subsystem := range subsystems.SubsystemsInstance {
+		rootPath := subsystems.FindHierarchyMountRootPath(subsystem.Name())
+		if rootPath == "" {
+			continue
+		}
+		dirs, err := ioutil.ReadDir(path.Join(rootPath, c.Path))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, dir := range dirs {
+			if dir.IsDir() && !seen[dir.Name()] {
+				seen[dir.Name()] = true
+				children = append(children, dir.Name())
+			}
+		}
+	}
+	return children, nil
+}
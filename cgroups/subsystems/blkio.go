@@ -0,0 +1,203 @@
+package subsystems
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// blkio.weight 的取值范围 (v1)
+	minBlkioWeight = 10
+	maxBlkioWeight = 1000
+)
+
+// ThrottleDevice 对某个块设备的读写速率限制
+type ThrottleDevice struct {
+	Path  string `json:"path"`  // 设备路径，比如 /dev/sda
+	Major uint32 `json:"major"` // 主设备号
+	Minor uint32 `json:"minor"` // 次设备号
+	Rate  uint64 `json:"rate"`  // 每秒字节数或每秒IO次数
+}
+
+func (t *ThrottleDevice) String() string {
+	return fmt.Sprintf("%d:%d %d", t.Major, t.Minor, t.Rate)
+}
+
+type BlkioSubsystem struct {
+
+}
+
+func (b *BlkioSubsystem) Name() string {
+	return "blkio"
+}
+
+func (b *BlkioSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if res.BlkioWeight == 0 && len(res.BlkioDeviceReadBps) == 0 && len(res.BlkioDeviceWriteBps) == 0 &&
+		len(res.BlkioDeviceReadIOps) == 0 && len(res.BlkioDeviceWriteIOps) == 0 {
+		return nil
+	}
+
+	subsystemCgroupPath, err := GetCgroupPath(b.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+
+	if IsCgroup2UnifiedMode() {
+		return b.setV2(subsystemCgroupPath, res)
+	}
+	return b.setV1(subsystemCgroupPath, res)
+}
+
+func (b *BlkioSubsystem) setV1(subsystemCgroupPath string, res *ResourceConfig) error {
+	if res.BlkioWeight != 0 {
+		// 使用 BFQ 调度器的新内核上只有 blkio.bfq.weight
+		err := writeFirstExisting(subsystemCgroupPath, []string{"blkio.weight", "blkio.bfq.weight"}, strconv.Itoa(res.BlkioWeight))
+		if err != nil {
+			return fmt.Errorf("set cgroup blkio weight failed, error: %v", err)
+		}
+	}
+
+	throttles := []struct {
+		file    string
+		devices []ThrottleDevice
+	}{
+		{"blkio.throttle.read_bps_device", res.BlkioDeviceReadBps},
+		{"blkio.throttle.write_bps_device", res.BlkioDeviceWriteBps},
+		{"blkio.throttle.read_iops_device", res.BlkioDeviceReadIOps},
+		{"blkio.throttle.write_iops_device", res.BlkioDeviceWriteIOps},
+	}
+	for _, throttle := range throttles {
+		// 每次只能写入一个设备的限制
+		for _, device := range throttle.devices {
+			err := ioutil.WriteFile(path.Join(subsystemCgroupPath, throttle.file), []byte(device.String()), 0644)
+			if err != nil {
+				return fmt.Errorf("set cgroup %s failed, device: %s, error: %v", throttle.file, device.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (b *BlkioSubsystem) setV2(subsystemCgroupPath string, res *ResourceConfig) error {
+	if res.BlkioWeight != 0 {
+		weight := fmt.Sprintf("default %d", blkioWeightToIOWeight(res.BlkioWeight))
+		err := writeFirstExisting(subsystemCgroupPath, []string{"io.weight", "io.bfq.weight"}, weight)
+		if err != nil {
+			return fmt.Errorf("set cgroup io weight failed, error: %v", err)
+		}
+	}
+
+	// v2 中同一个设备的所有限制写在 io.max 的同一行中，格式为：
+	// 8:0 rbps=1048576 wbps=max riops=max wiops=1000
+	type deviceLimit struct {
+		device string
+		limits []string
+	}
+	var devices []*deviceLimit
+	byDevice := make(map[string]*deviceLimit)
+	addLimit := func(key string, throttles []ThrottleDevice) {
+		for _, t := range throttles {
+			id := fmt.Sprintf("%d:%d", t.Major, t.Minor)
+			d, ok := byDevice[id]
+			if !ok {
+				d = &deviceLimit{device: id}
+				byDevice[id] = d
+				devices = append(devices, d)
+			}
+			d.limits = append(d.limits, fmt.Sprintf("%s=%d", key, t.Rate))
+		}
+	}
+	addLimit("rbps", res.BlkioDeviceReadBps)
+	addLimit("wbps", res.BlkioDeviceWriteBps)
+	addLimit("riops", res.BlkioDeviceReadIOps)
+	addLimit("wiops", res.BlkioDeviceWriteIOps)
+
+	for _, d := range devices {
+		line := fmt.Sprintf("%s %s", d.device, strings.Join(d.limits, " "))
+		err := ioutil.WriteFile(path.Join(subsystemCgroupPath, "io.max"), []byte(line), 0644)
+		if err != nil {
+			return fmt.Errorf("set cgroup io.max failed, limit: %s, error: %v", line, err)
+		}
+	}
+	return nil
+}
+
+func (b *BlkioSubsystem) AddProcess(cgroupPath string, pid int) error {
+	return addProcess(b.Name(), cgroupPath, pid)
+}
+
+func (b *BlkioSubsystem) RemoveCgroup(cgroupPath string) error {
+	return removeCgroup(b.Name(), cgroupPath)
+}
+
+// 将 v1 的 blkio.weight [10, 1000] 线性地换算成 v2 的 io.weight [1, 10000]
+func blkioWeightToIOWeight(weight int) int {
+	return 1 + (weight-minBlkioWeight)*9999/(maxBlkioWeight-minBlkioWeight)
+}
+
+// 写入候选文件中第一个存在的文件
+func writeFirstExisting(dir string, files []string, content string) error {
+	for _, file := range files {
+		filePath := path.Join(dir, file)
+		if _, err := os.Stat(filePath); err == nil {
+			return ioutil.WriteFile(filePath, []byte(content), 0644)
+		}
+	}
+	return fmt.Errorf("none of %s exists", strings.Join(files, ", "))
+}
+
+// ParseThrottleDevices 解析 <设备路径>:<速率> 格式的设备限速参数，比如 /dev/sda:10mb 或 /dev/sda:1000
+// isBps 为 true 时速率的单位为字节，支持 kb、mb、gb 等单位；否则速率为每秒IO次数
+func ParseThrottleDevices(values []string, isBps bool) ([]ThrottleDevice, error) {
+	var devices []ThrottleDevice
+	for _, value := range values {
+		idx := strings.LastIndex(value, ":")
+		if idx <= 0 || idx == len(value)-1 {
+			return nil, fmt.Errorf("invalid device rate %q, the format is <device-path>:<rate>", value)
+		}
+		devicePath, rateStr := value[:idx], value[idx+1:]
+
+		var rate uint64
+		var err error
+		if isBps {
+			var bytes int64
+			bytes, err = ParseBytes(rateStr)
+			rate = uint64(bytes)
+		} else {
+			rate, err = strconv.ParseUint(rateStr, 10, 64)
+		}
+		if err != nil || rate == 0 {
+			return nil, fmt.Errorf("invalid rate %q of device %s", rateStr, devicePath)
+		}
+
+		major, minor, err := deviceNumber(devicePath)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, ThrottleDevice{
+			Path:  devicePath,
+			Major: major,
+			Minor: minor,
+			Rate:  rate,
+		})
+	}
+	return devices, nil
+}
+
+// 获取块设备的主次设备号
+func deviceNumber(devicePath string) (uint32, uint32, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(devicePath, &st); err != nil {
+		return 0, 0, fmt.Errorf("stat device %s failed, error: %v", devicePath, err)
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFBLK {
+		return 0, 0, fmt.Errorf("%s is not a block device", devicePath)
+	}
+	return unix.Major(st.Rdev), unix.Minor(st.Rdev), nil
+}
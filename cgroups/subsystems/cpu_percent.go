@@ -3,11 +3,13 @@ package subsystems
 import (
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path"
 	"strconv"
 )
 
+// cfs 调度的默认周期 (单位: 微秒)
+const defaultCPUPeriod = 100000
+
 type CPUPercentageSubsystem struct {
 
 }
@@ -17,48 +19,52 @@ func (c *CPUPercentageSubsystem) Name() string {
 }
 
 func (c *CPUPercentageSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	// 没有设置cpu使用上限则不需要做任何事，新建的cgroup默认就是无限制的
+	// -1 表示明确要求取消限制，比如通过 update 命令取消之前设置的限制
+	if res.CPUPercentage == 0 && res.CPUs == 0 {
+		return nil
+	}
+
 	subsystemCgroupPath, err := GetCgroupPath(c.Name(), cgroupPath, true)
 	if err != nil {
 		return err
 	}
 
-	targetFilePath := path.Join(subsystemCgroupPath, "cpu.cfs_quota_us")
-
-	// 如果没传参数，默认设置为 -1
-	// -1表示cpu使用无限制
 	// CPUPercentage = 20 表示cpu使用上限为 20%
 	// CPUPercentage = 200 表示cpu使用上限为 200% 即两个cpu核 (前提是至少两个cpu核)
-	var percentage = -1
-	if res.CPUPercentage != -1 && res.CPUPercentage != 0 {
-		percentage = res.CPUPercentage * 1000
+	// CPUs = 1.5 表示最多使用一个半cpu核，即每个周期内可以使用 1.5 个周期的cpu时间
+	quota := res.CPUPercentage * defaultCPUPeriod / 100
+	if res.CPUs > 0 {
+		quota = int(res.CPUs * defaultCPUPeriod)
+	} else if res.CPUPercentage == -1 {
+		quota = -1
 	}
 
-	err = ioutil.WriteFile(targetFilePath, []byte(strconv.Itoa(percentage)), 0644)
+	if IsCgroup2UnifiedMode() {
+		// v2 的 cpu.max 格式为 "$MAX $PERIOD"，不限制时 $MAX 为 "max"
+		content := fmt.Sprintf("%d %d", quota, defaultCPUPeriod)
+		if quota == -1 {
+			content = fmt.Sprintf("max %d", defaultCPUPeriod)
+		}
+		err = ioutil.WriteFile(path.Join(subsystemCgroupPath, "cpu.max"), []byte(content), 0644)
+	} else {
+		// 周期和配额需要一起设置，避免之前设置过的周期与当前配额不匹配
+		err = ioutil.WriteFile(path.Join(subsystemCgroupPath, "cpu.cfs_period_us"), []byte(strconv.Itoa(defaultCPUPeriod)), 0644)
+		if err == nil {
+			err = ioutil.WriteFile(path.Join(subsystemCgroupPath, "cpu.cfs_quota_us"), []byte(strconv.Itoa(quota)), 0644)
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("set cgroup cpu amount failed, error: %v", err)
+		return fmt.Errorf("set cgroup cpu percentage failed, error: %v", err)
 	}
 	return nil
 }
 
 func (c *CPUPercentageSubsystem) AddProcess(cgroupPath string, pid int) error {
-	subsystemCgroupPath, err := GetCgroupPath(c.Name(), cgroupPath, false)
-	if err != nil {
-		return err
-	}
 	// todo: 去重  cpu_share 和 cpu_percentage 在同一个cgroup目录下，同一个进程会在tasks中添加两次
-	targetFilePath := path.Join(subsystemCgroupPath, "tasks")
-	err = ioutil.WriteFile(targetFilePath, []byte(strconv.Itoa(pid)), 0644)
-	if err != nil {
-		return fmt.Errorf("cgroup add process failed, write tasks fail, error: %v", err)
-	}
-	return nil
+	return addProcess(c.Name(), cgroupPath, pid)
 }
 
 func (c *CPUPercentageSubsystem) RemoveCgroup(cgroupPath string) error {
-	subsystemCgroupPath, err := GetCgroupPath(c.Name(), cgroupPath, false)
-	if err != nil {
-		return err
-	}
-
-	return os.RemoveAll(subsystemCgroupPath)
+	return removeCgroup(c.Name(), cgroupPath)
 }
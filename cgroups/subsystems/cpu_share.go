@@ -0,0 +1,60 @@
+package subsystems
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+)
+
+const (
+	// cpu.shares 的取值范围 (v1)
+	minCPUShare = 2
+	maxCPUShare = 262144
+)
+
+type CPUShareSubsystem struct {
+
+}
+
+func (c *CPUShareSubsystem) Name() string {
+	return "cpu"
+}
+
+func (c *CPUShareSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	// 没有设置则使用cgroup默认的权重 (v1 为 1024，v2 为 100)
+	if res.CPUShare == 0 {
+		return nil
+	}
+
+	subsystemCgroupPath, err := GetCgroupPath(c.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+
+	// cpu.shares 是一个相对权重，只有在cpu资源紧张时才会起作用：
+	// 两个容器的 shares 分别为 1024 和 512 时，cpu繁忙的情况下它们分到的cpu时间比例为 2:1
+	if IsCgroup2UnifiedMode() {
+		err = ioutil.WriteFile(path.Join(subsystemCgroupPath, "cpu.weight"), []byte(strconv.Itoa(sharesToWeight(res.CPUShare))), 0644)
+	} else {
+		err = ioutil.WriteFile(path.Join(subsystemCgroupPath, "cpu.shares"), []byte(strconv.Itoa(res.CPUShare)), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("set cgroup cpu share failed, error: %v", err)
+	}
+	return nil
+}
+
+func (c *CPUShareSubsystem) AddProcess(cgroupPath string, pid int) error {
+	return addProcess(c.Name(), cgroupPath, pid)
+}
+
+func (c *CPUShareSubsystem) RemoveCgroup(cgroupPath string) error {
+	return removeCgroup(c.Name(), cgroupPath)
+}
+
+// 将 v1 的 cpu.shares [2, 262144] 线性地换算成 v2 的 cpu.weight [1, 10000]
+// 换算方式与 runc 保持一致，默认的 1024 会被换算成 39
+func sharesToWeight(shares int) int {
+	return 1 + ((shares-minCPUShare)*9999)/(maxCPUShare-minCPUShare)
+}
@@ -0,0 +1,23 @@
+package subsystems
+
+// CPUAcctSubsystem 只用于统计cgroup的cpu使用时间，不做任何限制
+// 有些宿主机上 cpuacct 和 cpu 并没有挂载在同一个 hierarchy 上，所以需要单独把进程加入 cpuacct 的cgroup中
+type CPUAcctSubsystem struct {
+
+}
+
+func (c *CPUAcctSubsystem) Name() string {
+	return "cpuacct"
+}
+
+func (c *CPUAcctSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	return nil
+}
+
+func (c *CPUAcctSubsystem) AddProcess(cgroupPath string, pid int) error {
+	return addProcess(c.Name(), cgroupPath, pid)
+}
+
+func (c *CPUAcctSubsystem) RemoveCgroup(cgroupPath string) error {
+	return removeCgroup(c.Name(), cgroupPath)
+}
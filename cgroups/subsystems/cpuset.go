@@ -1,21 +1,193 @@
 package subsystems
 
-type CPUShareSubsystem struct {
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// 宿主机上在线的cpu和内存节点列表
+	hostOnlineCPUsPath = "/sys/devices/system/cpu/online"
+	hostOnlineMemsPath = "/sys/devices/system/node/online"
+)
+
+type CPUAmountSubsystem struct {
 
 }
 
-func (c *CPUShareSubsystem) Name() string {
-	return "cpu"
+func (c *CPUAmountSubsystem) Name() string {
+	return "cpuset"
 }
 
-func (c *CPUShareSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+func (c *CPUAmountSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if res.CpusetCpus == "" && res.CpusetMems == "" {
+		return nil
+	}
+
+	subsystemCgroupPath, err := c.getCgroupPath(cgroupPath)
+	if err != nil {
+		return err
+	}
+
+	if res.CpusetCpus != "" {
+		err = ioutil.WriteFile(path.Join(subsystemCgroupPath, "cpuset.cpus"), []byte(res.CpusetCpus), 0644)
+		if err != nil {
+			return fmt.Errorf("set cgroup cpuset.cpus failed, error: %v", err)
+		}
+	}
+	if res.CpusetMems != "" {
+		err = ioutil.WriteFile(path.Join(subsystemCgroupPath, "cpuset.mems"), []byte(res.CpusetMems), 0644)
+		if err != nil {
+			return fmt.Errorf("set cgroup cpuset.mems failed, error: %v", err)
+		}
+	}
 	return nil
 }
 
-func (c *CPUShareSubsystem) AddProcess(cgroupPath string, pid int) error {
+func (c *CPUAmountSubsystem) AddProcess(cgroupPath string, pid int) error {
+	// 保证cpuset.cpus和cpuset.mems已经初始化，否则进程无法加入该cgroup
+	if _, err := c.getCgroupPath(cgroupPath); err != nil {
+		return err
+	}
+	return addProcess(c.Name(), cgroupPath, pid)
+}
+
+func (c *CPUAmountSubsystem) RemoveCgroup(cgroupPath string) error {
+	return removeCgroup(c.Name(), cgroupPath)
+}
+
+// 获取(并自动创建)cpuset子系统下的cgroup目录
+// cgroup v1 中新建的cpuset cgroup 的 cpuset.cpus 和 cpuset.mems 都是空的，
+// 在写入这两个文件之前任何进程都无法加入该cgroup，所以需要从根节点开始逐级从父cgroup继承这两个值
+func (c *CPUAmountSubsystem) getCgroupPath(cgroupPath string) (string, error) {
+	subsystemCgroupPath, err := GetCgroupPath(c.Name(), cgroupPath, true)
+	if err != nil {
+		return "", err
+	}
+	if IsCgroup2UnifiedMode() {
+		// v2 下为空表示直接使用父cgroup的配置，不需要额外处理
+		return subsystemCgroupPath, nil
+	}
+
+	dir := FindHierarchyMountRootPath(c.Name())
+	for _, elem := range strings.Split(strings.Trim(path.Clean(cgroupPath), "/"), "/") {
+		parent := dir
+		dir = path.Join(dir, elem)
+		for _, file := range []string{"cpuset.cpus", "cpuset.mems"} {
+			err = inheritFromParent(parent, dir, file)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	return subsystemCgroupPath, nil
+}
+
+// 当前cgroup的配置文件内容为空时，将父cgroup中对应文件的内容写入其中
+func inheritFromParent(parent, current, file string) error {
+	content, err := ioutil.ReadFile(path.Join(current, file))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(content)) != "" {
+		return nil
+	}
+
+	content, err = ioutil.ReadFile(path.Join(parent, file))
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path.Join(current, file), []byte(strings.TrimSpace(string(content))), 0644)
+	if err != nil {
+		return fmt.Errorf("init %s of %s failed, error: %v", file, current, err)
+	}
 	return nil
 }
 
-func (c *CPUShareSubsystem) RemoveCgroup(cgroupPath string) error {
+// ValidateCpuset 检查用户设置的cpu列表和内存节点列表是否存在于宿主机上
+func ValidateCpuset(cpus, mems string) error {
+	if cpus != "" {
+		err := checkListAvailable("cpuset-cpus", cpus, hostOnlineCPUsPath)
+		if err != nil {
+			return err
+		}
+	}
+	if mems != "" {
+		err := checkListAvailable("cpuset-mems", mems, hostOnlineMemsPath)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+func checkListAvailable(name, list, hostListPath string) error {
+	requested, err := parseCPUList(list)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %v", name, list, err)
+	}
+
+	// 没有NUMA的机器上可能不存在 /sys/devices/system/node，此时只有0号内存节点
+	hostList := "0"
+	content, err := ioutil.ReadFile(hostListPath)
+	if err == nil {
+		hostList = strings.TrimSpace(string(content))
+	}
+	available, err := parseCPUList(hostList)
+	if err != nil {
+		return fmt.Errorf("parse %s failed: %v", hostListPath, err)
+	}
+
+	var unavailable []string
+	for _, id := range requested.sortedIDs() {
+		if !available[id] {
+			unavailable = append(unavailable, strconv.Itoa(id))
+		}
+	}
+	if len(unavailable) > 0 {
+		return fmt.Errorf("%s %s not available on host (online: %s)", name, strings.Join(unavailable, ","), hostList)
+	}
+	return nil
+}
+
+// 解析cpuset的列表格式，比如 "0-3,5,7-8"，返回以编号为key的集合
+func parseCPUList(list string) (cpuSet, error) {
+	set := make(cpuSet)
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		if part == "" {
+			return nil, fmt.Errorf("empty item")
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid item %q", part)
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.Atoi(bounds[1])
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+		}
+		for i := start; i <= end; i++ {
+			set[i] = true
+		}
+	}
+	return set, nil
+}
+
+type cpuSet map[int]bool
+
+// 按编号从小到大返回集合中的所有编号
+func (s cpuSet) sortedIDs() []int {
+	ids := make([]int, 0, len(s))
+	for id := range s {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
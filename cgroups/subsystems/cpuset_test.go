@@ -0,0 +1,28 @@
+package subsystems
+
+import (
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	set, err := parseCPUList("0-2,5,7-8")
+	assert.Equal(t, nil, err)
+	assert.DeepEqual(t, []int{0, 1, 2, 5, 7, 8}, set.sortedIDs())
+
+	set, err = parseCPUList("3")
+	assert.Equal(t, nil, err)
+	assert.DeepEqual(t, []int{3}, set.sortedIDs())
+
+	// 非法的格式
+	for _, list := range []string{"", "a", "1,", "3-1", "-1", "1-b"} {
+		_, err = parseCPUList(list)
+		assert.Assert(t, err != nil, list)
+	}
+}
+
+func TestSharesToWeight(t *testing.T) {
+	assert.Equal(t, 1, sharesToWeight(minCPUShare))
+	assert.Equal(t, 39, sharesToWeight(1024))
+	assert.Equal(t, 10000, sharesToWeight(maxCPUShare))
+}
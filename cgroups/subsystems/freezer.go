@@ -0,0 +1,148 @@
+package subsystems
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 冻结状态 (与 v1 的 freezer.state 中的取值一致)
+	Thawed   = "THAWED"
+	Freezing = "FREEZING"
+	Frozen   = "FROZEN"
+
+	// 等待冻结/解冻完成时的轮询间隔和最大轮询次数
+	freezerPollInterval = 10 * time.Millisecond
+	freezerPollTimes    = 1000
+)
+
+// FreezerSubsystem 用于暂停和恢复 cgroup 中的所有进程
+// 容器创建时只需要将进程加入 freezer cgroup，真正的冻结和解冻由 pause/continue 命令触发
+type FreezerSubsystem struct {
+
+}
+
+func (f *FreezerSubsystem) Name() string {
+	return "freezer"
+}
+
+func (f *FreezerSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	return nil
+}
+
+func (f *FreezerSubsystem) AddProcess(cgroupPath string, pid int) error {
+	return addProcess(f.Name(), cgroupPath, pid)
+}
+
+func (f *FreezerSubsystem) RemoveCgroup(cgroupPath string) error {
+	return removeCgroup(f.Name(), cgroupPath)
+}
+
+// Freeze 冻结 cgroup 中的所有进程，并等待冻结完成
+func (f *FreezerSubsystem) Freeze(cgroupPath string) error {
+	return f.setState(cgroupPath, Frozen)
+}
+
+// Thaw 解冻 cgroup 中的所有进程，并等待解冻完成
+func (f *FreezerSubsystem) Thaw(cgroupPath string) error {
+	return f.setState(cgroupPath, Thawed)
+}
+
+// State 获取 cgroup 当前的冻结状态
+// v1 直接读取 freezer.state；v2 的 cgroup.freeze 为期望的状态，cgroup.events 中的 frozen 为实际的状态
+func (f *FreezerSubsystem) State(cgroupPath string) (string, error) {
+	subsystemCgroupPath, err := GetCgroupPath(f.Name(), cgroupPath, false)
+	if err != nil {
+		return "", err
+	}
+
+	if !IsCgroup2UnifiedMode() {
+		content, err := ioutil.ReadFile(path.Join(subsystemCgroupPath, "freezer.state"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(content)), nil
+	}
+
+	desired, err := ioutil.ReadFile(path.Join(subsystemCgroupPath, "cgroup.freeze"))
+	if err != nil {
+		return "", err
+	}
+	events, err := readKeyValues(path.Join(subsystemCgroupPath, "cgroup.events"))
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case events["frozen"] == 1:
+		return Frozen, nil
+	case strings.TrimSpace(string(desired)) == "1":
+		return Freezing, nil
+	default:
+		return Thawed, nil
+	}
+}
+
+// Pids 获取 cgroup 中的所有进程
+// 容器的所有进程都会被加入 freezer cgroup，所以 freezer cgroup 中的进程就是容器的全部进程，cgroup 不存在时返回空
+func (f *FreezerSubsystem) Pids(cgroupPath string) ([]int, error) {
+	cgroupRootPath := FindHierarchyMountRootPath(f.Name())
+	if cgroupRootPath == "" {
+		return nil, fmt.Errorf("cgroup hierarchy of subsystem %s not found", f.Name())
+	}
+
+	content, err := ioutil.ReadFile(path.Join(cgroupRootPath, cgroupPath, "cgroup.procs"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, line := range strings.Fields(string(content)) {
+		pid, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pid %s in cgroup.procs", line)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// 设置冻结状态，并轮询直到状态切换完成
+// v1 在 FREEZING 状态下可能因为有进程正在 fork 而无法完成冻结，所以每次轮询都重新写入一次
+func (f *FreezerSubsystem) setState(cgroupPath, state string) error {
+	subsystemCgroupPath, err := GetCgroupPath(f.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+
+	stateFile, content := "freezer.state", state
+	if IsCgroup2UnifiedMode() {
+		stateFile, content = "cgroup.freeze", "0"
+		if state == Frozen {
+			content = "1"
+		}
+	}
+
+	for i := 0; i < freezerPollTimes; i++ {
+		err = ioutil.WriteFile(path.Join(subsystemCgroupPath, stateFile), []byte(content), 0644)
+		if err != nil {
+			return fmt.Errorf("write %s failed, error: %v", stateFile, err)
+		}
+		current, err := f.State(cgroupPath)
+		if err != nil {
+			return err
+		}
+		if current == state {
+			return nil
+		}
+		time.Sleep(freezerPollInterval)
+	}
+	return fmt.Errorf("timeout waiting for cgroup to become %s", state)
+}
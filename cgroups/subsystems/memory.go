@@ -3,7 +3,6 @@ package subsystems
 import (
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path"
 	"strconv"
 )
@@ -17,48 +16,213 @@ func (m *MemorySubsystem) Name() string {
 }
 
 func (m *MemorySubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	// 没有设置任何内存相关的限制则不需要做任何事，默认的内存限制由调用方从配置文件中获取并填充
+	if res.MemoryLimit == "" && res.MemorySwap == "" && res.MemoryReservation == "" && res.MemorySwappiness == nil && !res.OomKillDisable {
+		return nil
+	}
+
 	subsystemCgroupPath, err := GetCgroupPath(m.Name(), cgroupPath, true)
 	if err != nil {
 		return err
 	}
 
-	// 如果用户没有设置内存限制，则使用默认的内存限制
-	// 目前是写死一个数，后期可以获取系统的最大内存数或者从配置文件中获取
-	memoryLimit := "512m"
-	if res.MemoryLimit != "" {
-		memoryLimit = res.MemoryLimit
+	if IsCgroup2UnifiedMode() {
+		err = m.setV2(subsystemCgroupPath, res)
+	} else {
+		err = m.setV1(subsystemCgroupPath, res)
 	}
-
-	// 将内存限制写入对应的文件中，即可达到限制资源的目的
-	err = ioutil.WriteFile(path.Join(subsystemCgroupPath, "memory.limit_in_bytes"), []byte(memoryLimit), 0644)
 	if err != nil {
 		return fmt.Errorf("set cgroup memory limit failed, error: %v", err)
 	}
 	return nil
 }
 
-func (m *MemorySubsystem) AddProcess(cgroupPath string, pid int) error {
-	subsystemCgroupPath, err := GetCgroupPath(m.Name(), cgroupPath, false)
+// v1：
+// memory.limit_in_bytes 内存硬限制 (-1 表示不限制)
+// memory.memsw.limit_in_bytes 内存+swap的总限制，需要内核开启 swap 记账
+// memory.soft_limit_in_bytes 内存软限制，内存紧张时优先回收超出软限制的cgroup的内存
+// memory.swappiness 使用swap的倾向 (0-100)
+// memory.oom_control 写入 1 表示禁用 OOM killer
+func (m *MemorySubsystem) setV1(dir string, res *ResourceConfig) error {
+	limit, err := memoryLimitValue(res.MemoryLimit)
 	if err != nil {
 		return err
 	}
-
-	// 将进程的pid写入对应的文件中，即完成了将进程添加到了指定的cgroup中
-	err = ioutil.WriteFile(path.Join(subsystemCgroupPath, "tasks"), []byte(strconv.Itoa(pid)), 0644)
+	swap, err := memoryLimitValue(res.MemorySwap)
 	if err != nil {
-		return fmt.Errorf("cgroup add process failed, error: %v", err)
+		return err
+	}
+
+	// memory.memsw.limit_in_bytes 必须大于等于 memory.limit_in_bytes，所以写入顺序取决于新的限制是变大还是变小：
+	// 新的总限制比当前的内存限制大时先写 memsw，否则先写内存限制
+	swapFirst := false
+	if swap != "" {
+		current, err := readUint(path.Join(dir, "memory.limit_in_bytes"))
+		if err != nil {
+			return err
+		}
+		newSwap, _ := strconv.ParseInt(swap, 10, 64)
+		swapFirst = newSwap == -1 || uint64(newSwap) > current
+	}
+	files := []struct {
+		name  string
+		value string
+	}{
+		{"memory.limit_in_bytes", limit},
+		{"memory.memsw.limit_in_bytes", swap},
+	}
+	if swapFirst {
+		files[0], files[1] = files[1], files[0]
+	}
+	for _, file := range files {
+		if file.value == "" {
+			continue
+		}
+		if err = ioutil.WriteFile(path.Join(dir, file.name), []byte(file.value), 0644); err != nil {
+			return fmt.Errorf("write %s failed, error: %v", file.name, err)
+		}
+	}
+
+	if res.MemoryReservation != "" {
+		reservation, err := memoryLimitValue(res.MemoryReservation)
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(path.Join(dir, "memory.soft_limit_in_bytes"), []byte(reservation), 0644); err != nil {
+			return fmt.Errorf("write memory.soft_limit_in_bytes failed, error: %v", err)
+		}
+	}
+	if res.MemorySwappiness != nil {
+		swappiness := strconv.FormatInt(*res.MemorySwappiness, 10)
+		if err = ioutil.WriteFile(path.Join(dir, "memory.swappiness"), []byte(swappiness), 0644); err != nil {
+			return fmt.Errorf("write memory.swappiness failed, error: %v", err)
+		}
+	}
+	if res.OomKillDisable {
+		if err = ioutil.WriteFile(path.Join(dir, "memory.oom_control"), []byte("1"), 0644); err != nil {
+			return fmt.Errorf("write memory.oom_control failed, error: %v", err)
+		}
 	}
 	return nil
 }
 
-func (m *MemorySubsystem) RemoveCgroup(cgroupPath string) error {
-	subsystemCgroupPath, err := GetCgroupPath(m.Name(), cgroupPath, false)
+// v2：
+// memory.max 内存硬限制 ("max" 表示不限制)
+// memory.swap.max 只限制swap的大小，所以需要用 内存+swap的总限制 减去 内存限制
+// memory.low 内存软限制，内存紧张时尽量不回收低于该值的内存
+// v2 没有 swappiness 和禁用 OOM killer 的接口，在 Validate 中已经拒绝了这两个参数
+func (m *MemorySubsystem) setV2(dir string, res *ResourceConfig) error {
+	if res.MemoryLimit != "" {
+		limit, err := memoryLimitValue(res.MemoryLimit)
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(path.Join(dir, "memory.max"), []byte(limit), 0644); err != nil {
+			return fmt.Errorf("write memory.max failed, error: %v", err)
+		}
+	}
+	if res.MemorySwap != "" {
+		swap := "max"
+		if res.MemorySwap != "-1" {
+			total, err := ParseBytes(res.MemorySwap)
+			if err != nil {
+				return err
+			}
+			limit, err := ParseBytes(res.MemoryLimit)
+			if err != nil {
+				return err
+			}
+			swap = strconv.FormatInt(total-limit, 10)
+		}
+		if err := ioutil.WriteFile(path.Join(dir, "memory.swap.max"), []byte(swap), 0644); err != nil {
+			return fmt.Errorf("write memory.swap.max failed, error: %v", err)
+		}
+	}
+	if res.MemoryReservation != "" {
+		reservation, err := memoryLimitValue(res.MemoryReservation)
+		if err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(path.Join(dir, "memory.low"), []byte(reservation), 0644); err != nil {
+			return fmt.Errorf("write memory.low failed, error: %v", err)
+		}
+	}
+	return nil
+}
+
+// 将用户设置的内存限制 (比如 512m、1.5g，-1 表示不限制) 转换为写入 cgroup 文件的字节数
+// 没有设置时返回空字符串
+func memoryLimitValue(limit string) (string, error) {
+	if limit == "" {
+		return "", nil
+	}
+	if limit == "-1" {
+		if IsCgroup2UnifiedMode() {
+			return "max", nil
+		}
+		return "-1", nil
+	}
+	bytes, err := ParseBytes(limit)
 	if err != nil {
-		fmt.Println(fmt.Errorf("get cgroup path failed, error: %v", err))
-		return err
+		return "", err
+	}
+	return strconv.FormatInt(bytes, 10), nil
+}
+
+// 校验内存相关的限制，所有的容量都使用与 -m 相同的单位
+func validateMemory(r *ResourceConfig) error {
+	sizes := map[string]string{
+		"memory limit":       r.MemoryLimit,
+		"memory swap":        r.MemorySwap,
+		"memory reservation": r.MemoryReservation,
+	}
+	values := make(map[string]int64)
+	for name, size := range sizes {
+		if size == "" || size == "-1" {
+			continue
+		}
+		value, err := ParseBytes(size)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", name, size)
+		}
+		values[name] = value
+	}
+
+	limit, limited := values["memory limit"]
+	if r.MemorySwap != "" && r.MemorySwap != "-1" {
+		// memory-swap 是内存和swap的总和，等于内存限制时表示禁用swap
+		if !limited {
+			return fmt.Errorf("memory limit should be set when memory swap is set")
+		}
+		if values["memory swap"] < limit {
+			return fmt.Errorf("memory swap should be larger than or equal to memory limit")
+		}
 	}
+	if reservation, ok := values["memory reservation"]; ok && limited && reservation > limit {
+		return fmt.Errorf("memory reservation should be smaller than memory limit")
+	}
+	if r.MemoryReservation == "-1" && IsCgroup2UnifiedMode() {
+		return fmt.Errorf("invalid memory reservation: -1")
+	}
+	if r.MemorySwappiness != nil {
+		if *r.MemorySwappiness < 0 || *r.MemorySwappiness > 100 {
+			return fmt.Errorf("invalid memory swappiness %d, range is from 0 to 100", *r.MemorySwappiness)
+		}
+		if IsCgroup2UnifiedMode() {
+			return fmt.Errorf("memory swappiness is not supported on cgroup v2")
+		}
+	}
+	if r.OomKillDisable && IsCgroup2UnifiedMode() {
+		return fmt.Errorf("oom kill disable is not supported on cgroup v2")
+	}
+	return nil
+}
 
-	// 使用 os.Remove 可以移除参数所指定路径的文件或者文件夹。
-	// 这里移除整个 cgroup 文件夹，就等于是删除 cgroup
-	return os.RemoveAll(subsystemCgroupPath)
+func (m *MemorySubsystem) AddProcess(cgroupPath string, pid int) error {
+	// 将进程的pid写入对应的文件中，即完成了将进程添加到了指定的cgroup中
+	return addProcess(m.Name(), cgroupPath, pid)
+}
+
+func (m *MemorySubsystem) RemoveCgroup(cgroupPath string) error {
+	return removeCgroup(m.Name(), cgroupPath)
 }
@@ -0,0 +1,28 @@
+package subsystems
+
+import (
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestValidateMemory(t *testing.T) {
+	valid := []*ResourceConfig{
+		{MemoryLimit: "1g", MemorySwap: "1g"},
+		{MemoryLimit: "1g", MemorySwap: "2048mb", MemoryReservation: "768m"},
+		{MemoryLimit: "-1", MemorySwap: "-1"},
+		{MemoryReservation: "1.5g"},
+	}
+	for _, res := range valid {
+		assert.NilError(t, validateMemory(res), res.String())
+	}
+
+	invalid := []*ResourceConfig{
+		{MemoryLimit: "1x"},
+		{MemorySwap: "1g"},
+		{MemoryLimit: "1g", MemorySwap: "512m"},
+		{MemoryLimit: "512m", MemoryReservation: "1g"},
+	}
+	for _, res := range invalid {
+		assert.Assert(t, validateMemory(res) != nil, res.String())
+	}
+}
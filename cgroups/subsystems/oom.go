@@ -0,0 +1,134 @@
+package subsystems
+
+import (
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// NotifyOOM 监听 cgroup 的 OOM 事件，每发生一次 OOM 就向返回的 channel 发送一次通知
+// v1 通过 eventfd 注册到 cgroup.event_control 上监听 memory.oom_control，
+// v2 通过 inotify 监听 memory.events 文件的修改，并比较其中的 oom_kill 计数
+// cgroup 被删除之后 channel 会被关闭
+func NotifyOOM(cgroupPath string) (<-chan struct{}, error) {
+	subsystemCgroupPath, err := GetCgroupPath("memory", cgroupPath, false)
+	if err != nil {
+		return nil, err
+	}
+	if IsCgroup2UnifiedMode() {
+		return notifyOOMV2(subsystemCgroupPath)
+	}
+	return notifyOOMV1(subsystemCgroupPath)
+}
+
+func notifyOOMV1(dir string) (<-chan struct{}, error) {
+	oomControl, err := os.Open(path.Join(dir, "memory.oom_control"))
+	if err != nil {
+		return nil, err
+	}
+	efd, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
+	if err != nil {
+		oomControl.Close()
+		return nil, fmt.Errorf("create eventfd failed, error: %v", err)
+	}
+	eventFile := os.NewFile(uintptr(efd), "eventfd")
+
+	// 注册格式为 "<eventfd> <memory.oom_control 的 fd>"
+	content := fmt.Sprintf("%d %d", efd, oomControl.Fd())
+	err = ioutil.WriteFile(path.Join(dir, "cgroup.event_control"), []byte(content), 0700)
+	if err != nil {
+		eventFile.Close()
+		oomControl.Close()
+		return nil, fmt.Errorf("register oom event failed, error: %v", err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer func() {
+			close(ch)
+			eventFile.Close()
+			oomControl.Close()
+		}()
+		buf := make([]byte, 8)
+		for {
+			if _, err := eventFile.Read(buf); err != nil {
+				return
+			}
+			// cgroup 被删除时 eventfd 也会收到通知，此时需要退出
+			if _, err := os.Stat(path.Join(dir, "cgroup.event_control")); os.IsNotExist(err) {
+				return
+			}
+			if binary.LittleEndian.Uint64(buf) > 0 {
+				ch <- struct{}{}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func notifyOOMV2(dir string) (<-chan struct{}, error) {
+	eventsFile := path.Join(dir, "memory.events")
+	lastCount, err := readOOMKillCount(eventsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init failed, error: %v", err)
+	}
+	// cgroup 目录被删除时会收到 IN_IGNORED 事件，read 返回之后通过文件是否存在来判断
+	if _, err = unix.InotifyAddWatch(fd, eventsFile, unix.IN_MODIFY); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("inotify add watch failed, error: %v", err)
+	}
+	inotifyFile := os.NewFile(uintptr(fd), "inotify")
+
+	ch := make(chan struct{})
+	go func() {
+		defer func() {
+			close(ch)
+			inotifyFile.Close()
+		}()
+		buf := make([]byte, unix.SizeofInotifyEvent+unix.PathMax+1)
+		for {
+			if _, err := inotifyFile.Read(buf); err != nil {
+				return
+			}
+			count, err := readOOMKillCount(eventsFile)
+			if err != nil {
+				return
+			}
+			if count > lastCount {
+				lastCount = count
+				ch <- struct{}{}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// OOMKillCount 获取 cgroup 中因 OOM 被杀死的进程数
+// v2 读取 memory.events，v1 读取 memory.oom_control (需要 4.13 以上的内核，否则总是返回 0)
+func OOMKillCount(cgroupPath string) (uint64, error) {
+	subsystemCgroupPath, err := GetCgroupPath("memory", cgroupPath, false)
+	if err != nil {
+		return 0, err
+	}
+	if IsCgroup2UnifiedMode() {
+		return readOOMKillCount(path.Join(subsystemCgroupPath, "memory.events"))
+	}
+	return readOOMKillCount(path.Join(subsystemCgroupPath, "memory.oom_control"))
+}
+
+// 读取文件中 "oom_kill N" 这一行的计数
+func readOOMKillCount(file string) (uint64, error) {
+	values, err := readKeyValues(file)
+	if err != nil {
+		return 0, err
+	}
+	return values["oom_kill"], nil
+}
@@ -0,0 +1,62 @@
+package subsystems
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type PidsSubsystem struct {
+
+}
+
+func (p *PidsSubsystem) Name() string {
+	return "pids"
+}
+
+func (p *PidsSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	// 0 表示没有设置，-1 表示不限制
+	if res.PidsLimit == 0 {
+		return nil
+	}
+
+	subsystemCgroupPath, err := GetCgroupPath(p.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+
+	// 限制cgroup中的进程(包括线程)总数，超出之后 fork/clone 会直接失败，防止 fork 炸弹拖垮宿主机
+	limit := "max"
+	if res.PidsLimit > 0 {
+		limit = strconv.FormatInt(res.PidsLimit, 10)
+	}
+	err = ioutil.WriteFile(path.Join(subsystemCgroupPath, "pids.max"), []byte(limit), 0644)
+	if err != nil {
+		return fmt.Errorf("set cgroup pids limit failed, error: %v", err)
+	}
+	return nil
+}
+
+func (p *PidsSubsystem) AddProcess(cgroupPath string, pid int) error {
+	return addProcess(p.Name(), cgroupPath, pid)
+}
+
+func (p *PidsSubsystem) RemoveCgroup(cgroupPath string) error {
+	return removeCgroup(p.Name(), cgroupPath)
+}
+
+// Current 获取cgroup中当前的进程(包括线程)数
+func (p *PidsSubsystem) Current(cgroupPath string) (int64, error) {
+	subsystemCgroupPath, err := GetCgroupPath(p.Name(), cgroupPath, false)
+	if err != nil {
+		return 0, err
+	}
+
+	content, err := ioutil.ReadFile(path.Join(subsystemCgroupPath, "pids.current"))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+}
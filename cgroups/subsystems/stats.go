@@ -0,0 +1,228 @@
+package subsystems
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Stats cgroup的资源使用情况
+type Stats struct {
+	CPUUsage    uint64 // 累计使用的cpu时间 (单位: 纳秒)
+	MemoryUsage uint64 // 当前使用的内存 (不包括可以被回收的非活跃文件缓存)
+	MemoryLimit uint64 // 内存上限，没有限制时为宿主机的总内存
+	PidsCurrent uint64 // 当前的进程数
+	BlkioRead   uint64 // 累计从块设备读取的字节数
+	BlkioWrite  uint64 // 累计向块设备写入的字节数
+}
+
+// GetStats 读取cgroup中各个子系统的统计数据
+func GetStats(cgroupPath string) (*Stats, error) {
+	stats := new(Stats)
+	var err error
+	if IsCgroup2UnifiedMode() {
+		err = getStatsV2(cgroupPath, stats)
+	} else {
+		err = getStatsV1(cgroupPath, stats)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stats.MemoryLimit == 0 {
+		// 没有设置内存限制，则使用宿主机的总内存作为上限
+		stats.MemoryLimit, _ = hostMemTotal()
+	}
+	return stats, nil
+}
+
+func getStatsV1(cgroupPath string, stats *Stats) error {
+	dir, err := GetCgroupPath("cpuacct", cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	if stats.CPUUsage, err = readUint(path.Join(dir, "cpuacct.usage")); err != nil {
+		return err
+	}
+
+	dir, err = GetCgroupPath("memory", cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	if stats.MemoryUsage, err = readUint(path.Join(dir, "memory.usage_in_bytes")); err != nil {
+		return err
+	}
+	if stats.MemoryLimit, err = readUint(path.Join(dir, "memory.limit_in_bytes")); err != nil {
+		return err
+	}
+	// 没有设置限制时 memory.limit_in_bytes 是一个接近 int64 上限的数
+	if stats.MemoryLimit >= 1<<62 {
+		stats.MemoryLimit = 0
+	}
+	memStat, err := readKeyValues(path.Join(dir, "memory.stat"))
+	if err != nil {
+		return err
+	}
+	stats.MemoryUsage = subtractCache(stats.MemoryUsage, memStat["total_inactive_file"])
+
+	dir, err = GetCgroupPath("pids", cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	if stats.PidsCurrent, err = readUint(path.Join(dir, "pids.current")); err != nil {
+		return err
+	}
+
+	// blkio 不是必须的，没有该子系统时不影响其他数据的统计
+	dir, err = GetCgroupPath("blkio", cgroupPath, false)
+	if err == nil {
+		// 每行的格式为 "8:0 Read 1024"，需要把所有设备的读写字节数累加起来
+		lines, err := readLines(path.Join(dir, "blkio.throttle.io_service_bytes"))
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				continue
+			}
+			value, _ := strconv.ParseUint(fields[2], 10, 64)
+			switch fields[1] {
+			case "Read":
+				stats.BlkioRead += value
+			case "Write":
+				stats.BlkioWrite += value
+			}
+		}
+	}
+	return nil
+}
+
+func getStatsV2(cgroupPath string, stats *Stats) error {
+	// v2 下所有子系统共用一个目录
+	dir, err := GetCgroupPath("memory", cgroupPath, false)
+	if err != nil {
+		return err
+	}
+
+	cpuStat, err := readKeyValues(path.Join(dir, "cpu.stat"))
+	if err != nil {
+		return err
+	}
+	stats.CPUUsage = cpuStat["usage_usec"] * 1000
+
+	if stats.MemoryUsage, err = readUint(path.Join(dir, "memory.current")); err != nil {
+		return err
+	}
+	// 没有设置限制时 memory.max 的内容为 "max"，解析失败时保持为 0
+	stats.MemoryLimit, _ = readUint(path.Join(dir, "memory.max"))
+	memStat, err := readKeyValues(path.Join(dir, "memory.stat"))
+	if err != nil {
+		return err
+	}
+	stats.MemoryUsage = subtractCache(stats.MemoryUsage, memStat["inactive_file"])
+
+	if stats.PidsCurrent, err = readUint(path.Join(dir, "pids.current")); err != nil {
+		return err
+	}
+
+	// 每行的格式为 "8:0 rbytes=1024 wbytes=0 rios=1 wios=0 dbytes=0 dios=0"
+	lines, err := readLines(path.Join(dir, "io.stat"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value, _ := strconv.ParseUint(kv[1], 10, 64)
+			switch kv[0] {
+			case "rbytes":
+				stats.BlkioRead += value
+			case "wbytes":
+				stats.BlkioWrite += value
+			}
+		}
+	}
+	return nil
+}
+
+func subtractCache(usage, cache uint64) uint64 {
+	if cache < usage {
+		return usage - cache
+	}
+	return usage
+}
+
+// 获取宿主机的总内存 (单位: 字节)
+func hostMemTotal() (uint64, error) {
+	lines, err := readLines("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range lines {
+		// MemTotal:       16318412 kB
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb * 1024, nil
+		}
+	}
+	return 0, fmt.Errorf("MemTotal not found in /proc/meminfo")
+}
+
+func readUint(filePath string) (uint64, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+}
+
+// 读取 "key value" 格式的统计文件，比如 memory.stat、cpu.stat
+func readKeyValues(filePath string) (map[string]uint64, error) {
+	lines, err := readLines(filePath)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]uint64)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err == nil {
+			values[fields[0]] = value
+		}
+	}
+	return values, nil
+}
+
+func readLines(filePath string) ([]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
@@ -1,12 +1,29 @@
 package subsystems
 
-import "strings"
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
 
 type ResourceConfig struct {
-	MemoryLimit string
-	CPUPercentage int
-	CPUShare string
-	CPUAmount string
+	MemoryLimit string `json:"memory_limit"`
+	MemorySwap string `json:"memory_swap"`              // 内存+swap的总限制，等于 MemoryLimit 时表示禁用swap (-1 表示不限制)
+	MemoryReservation string `json:"memory_reservation"` // 内存软限制
+	MemorySwappiness *int64 `json:"memory_swappiness"`   // 使用swap的倾向 (0-100)，nil 表示没有设置
+	OomKillDisable bool `json:"oom_kill_disable"`        // 是否禁用 OOM killer
+	CPUPercentage int `json:"cpu_percentage"`
+	CPUs float64 `json:"cpus"`                // 可以使用的cpu核数，比如 1.5 (与 CPUPercentage 二选一)
+	CPUShare int `json:"cpu_share"`           // cpu的相对权重
+	CpusetCpus string `json:"cpuset_cpus"`    // 允许使用的cpu列表，比如 "0-2,4"
+	CpusetMems string `json:"cpuset_mems"`    // 允许使用的内存节点列表，比如 "0"
+	BlkioWeight int `json:"blkio_weight"`     // 块设备IO的相对权重
+	BlkioDeviceReadBps []ThrottleDevice `json:"blkio_device_read_bps"`     // 每个设备每秒最多读取的字节数
+	BlkioDeviceWriteBps []ThrottleDevice `json:"blkio_device_write_bps"`   // 每个设备每秒最多写入的字节数
+	BlkioDeviceReadIOps []ThrottleDevice `json:"blkio_device_read_iops"`   // 每个设备每秒最多的读次数
+	BlkioDeviceWriteIOps []ThrottleDevice `json:"blkio_device_write_iops"` // 每个设备每秒最多的写次数
+	PidsLimit int64 `json:"pids_limit"`       // 最大进程数 (-1 表示不限制)
 }
 
 type Subsystem interface {
@@ -23,14 +40,116 @@ type Subsystem interface {
 var SubsystemsInstance = []Subsystem{
 	&CPUPercentageSubsystem{},
 	&CPUShareSubsystem{},
-	//&CPUAmountSubsystem{},
+	&CPUAcctSubsystem{},
+	&CPUAmountSubsystem{},
 	&MemorySubsystem{},
+	&BlkioSubsystem{},
+	&PidsSubsystem{},
+	&FreezerSubsystem{},
+}
+
+// Validate 检查资源限制参数的合法性
+func (r *ResourceConfig) Validate() error {
+	if err := validateMemory(r); err != nil {
+		return err
+	}
+	if r.CPUPercentage < -1 {
+		return fmt.Errorf("invalid cpu percentage: %d", r.CPUPercentage)
+	}
+	if r.CPUs < 0 {
+		return fmt.Errorf("invalid cpus: %v", r.CPUs)
+	}
+	// cpus 小于 0.01 时计算出的 cfs_quota_us 会低于内核允许的最小值 1000
+	if r.CPUs > 0 && r.CPUs < 0.01 {
+		return fmt.Errorf("range of cpus is from 0.01 to %d.00, as there are only %d cpus available", runtime.NumCPU(), runtime.NumCPU())
+	}
+	if r.CPUs > float64(runtime.NumCPU()) {
+		return fmt.Errorf("range of cpus is from 0.01 to %d.00, as there are only %d cpus available", runtime.NumCPU(), runtime.NumCPU())
+	}
+	if r.CPUs > 0 && r.CPUPercentage > 0 {
+		return fmt.Errorf("cpus and cpu percentage cannot be set at the same time")
+	}
+	if r.CPUShare != 0 && (r.CPUShare < minCPUShare || r.CPUShare > maxCPUShare) {
+		return fmt.Errorf("invalid cpu share %d, range is from %d to %d", r.CPUShare, minCPUShare, maxCPUShare)
+	}
+	if r.BlkioWeight != 0 && (r.BlkioWeight < minBlkioWeight || r.BlkioWeight > maxBlkioWeight) {
+		return fmt.Errorf("invalid blkio weight %d, range is from %d to %d", r.BlkioWeight, minBlkioWeight, maxBlkioWeight)
+	}
+	if r.PidsLimit < -1 {
+		return fmt.Errorf("invalid pids limit: %d", r.PidsLimit)
+	}
+	return ValidateCpuset(r.CpusetCpus, r.CpusetMems)
+}
+
+// Merge 将 other 中设置了的限制合并到当前配置中，零值表示没有设置
+func (r *ResourceConfig) Merge(other *ResourceConfig) {
+	if other.MemoryLimit != "" {
+		r.MemoryLimit = other.MemoryLimit
+	}
+	if other.MemorySwap != "" {
+		r.MemorySwap = other.MemorySwap
+	}
+	if other.MemoryReservation != "" {
+		r.MemoryReservation = other.MemoryReservation
+	}
+	if other.MemorySwappiness != nil {
+		r.MemorySwappiness = other.MemorySwappiness
+	}
+	if other.OomKillDisable {
+		r.OomKillDisable = other.OomKillDisable
+	}
+	// cpu百分比和cpu核数二选一，设置其中一个时需要清除另一个
+	if other.CPUPercentage != 0 {
+		r.CPUPercentage = other.CPUPercentage
+		r.CPUs = 0
+	}
+	if other.CPUs != 0 {
+		r.CPUs = other.CPUs
+		r.CPUPercentage = 0
+	}
+	if other.CPUShare != 0 {
+		r.CPUShare = other.CPUShare
+	}
+	if other.CpusetCpus != "" {
+		r.CpusetCpus = other.CpusetCpus
+	}
+	if other.CpusetMems != "" {
+		r.CpusetMems = other.CpusetMems
+	}
+	if other.BlkioWeight != 0 {
+		r.BlkioWeight = other.BlkioWeight
+	}
+	if len(other.BlkioDeviceReadBps) > 0 {
+		r.BlkioDeviceReadBps = other.BlkioDeviceReadBps
+	}
+	if len(other.BlkioDeviceWriteBps) > 0 {
+		r.BlkioDeviceWriteBps = other.BlkioDeviceWriteBps
+	}
+	if len(other.BlkioDeviceReadIOps) > 0 {
+		r.BlkioDeviceReadIOps = other.BlkioDeviceReadIOps
+	}
+	if len(other.BlkioDeviceWriteIOps) > 0 {
+		r.BlkioDeviceWriteIOps = other.BlkioDeviceWriteIOps
+	}
+	if other.PidsLimit != 0 {
+		r.PidsLimit = other.PidsLimit
+	}
 }
 
 func (r *ResourceConfig) String() string {
 	var line []string
 	line = append(line, "MemoryLimit:", r.MemoryLimit)
-	line = append(line, "CpuShare:", r.CPUShare)
-	line = append(line, "CpuSet:", r.CPUAmount)
+	line = append(line, "MemorySwap:", r.MemorySwap)
+	line = append(line, "MemoryReservation:", r.MemoryReservation)
+	if r.MemorySwappiness != nil {
+		line = append(line, "MemorySwappiness:", strconv.FormatInt(*r.MemorySwappiness, 10))
+	}
+	line = append(line, "OomKillDisable:", strconv.FormatBool(r.OomKillDisable))
+	line = append(line, "Cpus:", strconv.FormatFloat(r.CPUs, 'f', -1, 64))
+	line = append(line, "CpuShare:", strconv.Itoa(r.CPUShare))
+	line = append(line, "CpuSet:", r.CpusetCpus)
+	line = append(line, "CpuSetMems:", r.CpusetMems)
+	line = append(line, "BlkioWeight:", strconv.Itoa(r.BlkioWeight))
+	line = append(line, "PidsLimit:", strconv.FormatInt(r.PidsLimit, 10))
 	return strings.Join(line, " ")
-}
\ No newline at end of file
+}
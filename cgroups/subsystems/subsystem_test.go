@@ -0,0 +1,27 @@
+package subsystems
+
+import (
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestValidateCPUs(t *testing.T) {
+	valid := []*ResourceConfig{
+		{},
+		{CPUs: 0.01},
+		{CPUs: 0.5},
+	}
+	for _, res := range valid {
+		assert.NilError(t, res.Validate(), res.String())
+	}
+
+	invalid := []*ResourceConfig{
+		{CPUs: -1},
+		{CPUs: 0.001},
+		{CPUs: 0.009},
+		{CPUs: 0.5, CPUPercentage: 50},
+	}
+	for _, res := range invalid {
+		assert.Assert(t, res.Validate() != nil, res.String())
+	}
+}
@@ -3,15 +3,51 @@ package subsystems
 import (
 	"bufio"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 )
 
+const (
+	// cgroup 的默认挂载点
+	defaultCgroupMountPoint = "/sys/fs/cgroup"
+	// cgroup2 文件系统的 magic number (见 linux/magic.h 中的 CGROUP2_SUPER_MAGIC)
+	cgroup2SuperMagic = 0x63677270
+)
+
+var (
+	isUnifiedOnce sync.Once
+	isUnified     bool
+)
+
+// IsCgroup2UnifiedMode 判断宿主机是否运行在 cgroup v2 的 unified 模式下
+// 只有 /sys/fs/cgroup 本身就是 cgroup2 文件系统时才算 unified 模式；
+// hybrid 模式下 (v1 的各个子系统 + /sys/fs/cgroup/unified) 依然使用 v1 的方式
+func IsCgroup2UnifiedMode() bool {
+	isUnifiedOnce.Do(func() {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(defaultCgroupMountPoint, &st); err != nil {
+			isUnified = false
+			return
+		}
+		isUnified = st.Type == cgroup2SuperMagic
+	})
+	return isUnified
+}
+
 // 获取某个 subsystem 所挂载的 hieararchy 上的虚拟文件系统（挂载后的文件夹）下的 cgroup 的路径。
 // 通过对这个目录的改写来改动 cgroup。
+// cgroup v2 下所有子系统共用同一个目录，autoCreate 时会顺带在各级父 cgroup 中开启对应的 controller
 func GetCgroupPath(subsystemName string, cgroupPath string, autoCreate bool) (string, error) {
 	cgroupRootPath := FindHierarchyMountRootPath(subsystemName)
+	if cgroupRootPath == "" {
+		return "", fmt.Errorf("cgroup hierarchy of subsystem %s not found", subsystemName)
+	}
 	// 拼接得到绝对路径
 	expectedPath := path.Join(cgroupRootPath, cgroupPath)
 
@@ -24,6 +60,12 @@ func GetCgroupPath(subsystemName string, cgroupPath string, autoCreate bool) (st
 				return "", fmt.Errorf("create cgroup path failed, error: %v", err)
 			}
 		}
+		if autoCreate && IsCgroup2UnifiedMode() {
+			err = enableController(cgroupRootPath, cgroupPath, subsystemName)
+			if err != nil {
+				return "", err
+			}
+		}
 		return expectedPath, nil
 	} else {
 		return "", fmt.Errorf("cgroup path error: %v", err)
@@ -39,7 +81,16 @@ func FindHierarchyMountRootPath(subsystemName string) string {
 	}
 	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
+	if IsCgroup2UnifiedMode() {
+		// cgroup v2 只有一个 hierarchy，所有子系统都挂在 cgroup2 的挂载点上
+		return findMountPointByFsType(f, "cgroup2")
+	}
+	return findMountPointBySubsystem(f, subsystemName)
+}
+
+// 在 mountinfo 中找到 super options 里包含指定子系统的 cgroup v1 挂载点
+func findMountPointBySubsystem(mountInfo io.Reader, subsystemName string) string {
+	scanner := bufio.NewScanner(mountInfo)
 	for scanner.Scan() {
 		txt := scanner.Text()
 		fields := strings.Split(txt, " ")
@@ -52,3 +103,146 @@ func FindHierarchyMountRootPath(subsystemName string) string {
 	}
 	return ""
 }
+
+// 在 mountinfo 中找到指定文件系统类型的挂载点
+// mountinfo 每行的格式为：36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+// 其中 "-" 之后的第一个字段就是文件系统类型
+func findMountPointByFsType(mountInfo io.Reader, fsType string) string {
+	scanner := bufio.NewScanner(mountInfo)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), " ")
+		for i := 6; i < len(fields)-1; i++ {
+			if fields[i] == "-" {
+				if fields[i+1] == fsType {
+					return fields[4]
+				}
+				break
+			}
+		}
+	}
+	return ""
+}
+
+// cgroup v1 子系统名与 cgroup v2 controller 名的对应关系
+// 返回空字符串表示该子系统在 v2 下属于 cgroup 的核心功能，不需要开启 controller
+func controllerName(subsystemName string) string {
+	switch subsystemName {
+	case "cpuacct":
+		return "cpu"
+	case "blkio":
+		return "io"
+	case "freezer":
+		return ""
+	default:
+		return subsystemName
+	}
+}
+
+// 在 cgroup v2 下，子 cgroup 只能使用父 cgroup 在 cgroup.subtree_control 中开启了的 controller
+// 所以需要从根节点开始，在容器 cgroup 的每一级父目录中开启对应的 controller
+func enableController(rootPath, cgroupPath, subsystemName string) error {
+	controller := controllerName(subsystemName)
+	if controller == "" {
+		return nil
+	}
+
+	dir := rootPath
+	for _, elem := range strings.Split(strings.Trim(path.Clean(cgroupPath), "/"), "/") {
+		available, err := ioutil.ReadFile(path.Join(dir, "cgroup.controllers"))
+		if err != nil {
+			return fmt.Errorf("read cgroup.controllers of %s failed, error: %v", dir, err)
+		}
+		if !containsField(string(available), controller) {
+			return fmt.Errorf("cgroup2 controller %s is not available in %s", controller, dir)
+		}
+
+		enabled, err := ioutil.ReadFile(path.Join(dir, "cgroup.subtree_control"))
+		if err != nil {
+			return fmt.Errorf("read cgroup.subtree_control of %s failed, error: %v", dir, err)
+		}
+		if !containsField(string(enabled), controller) {
+			err = ioutil.WriteFile(path.Join(dir, "cgroup.subtree_control"), []byte("+"+controller), 0644)
+			if err != nil {
+				return fmt.Errorf("enable controller %s in %s failed, error: %v", controller, dir, err)
+			}
+		}
+		dir = path.Join(dir, elem)
+	}
+	return nil
+}
+
+func containsField(content, field string) bool {
+	for _, f := range strings.Fields(content) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// 将进程加入指定子系统的 cgroup 中
+// v1 写 tasks 文件，v2 写 cgroup.procs 文件 (v2 下只能以进程为单位迁移)
+// 用户没有设置限制的子系统在 Set 时不会创建 cgroup 目录，所以这里需要自动创建
+func addProcess(subsystemName, cgroupPath string, pid int) error {
+	subsystemCgroupPath, err := GetCgroupPath(subsystemName, cgroupPath, true)
+	if err != nil {
+		return err
+	}
+
+	procsFile := "tasks"
+	if IsCgroup2UnifiedMode() {
+		procsFile = "cgroup.procs"
+	}
+	err = ioutil.WriteFile(path.Join(subsystemCgroupPath, procsFile), []byte(strconv.Itoa(pid)), 0644)
+	if err != nil {
+		return fmt.Errorf("cgroup add process failed, write %s fail, error: %v", procsFile, err)
+	}
+	return nil
+}
+
+// 移除指定子系统下的 cgroup 目录
+// cgroup v2 下各子系统共用一个目录，v1 下也可能有多个子系统挂载在同一个 hierarchy 上 (比如 cpu,cpuacct)，
+// 第一个子系统删除之后，后面的子系统就找不到该目录了，这属于正常情况
+func removeCgroup(subsystemName, cgroupPath string) error {
+	cgroupRootPath := FindHierarchyMountRootPath(subsystemName)
+	if cgroupRootPath == "" {
+		return nil
+	}
+	subsystemCgroupPath := path.Join(cgroupRootPath, cgroupPath)
+	if _, err := os.Stat(subsystemCgroupPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	// 使用 os.Remove 可以移除参数所指定路径的文件或者文件夹。
+	// 这里移除整个 cgroup 文件夹，就等于是删除 cgroup
+	return os.RemoveAll(subsystemCgroupPath)
+}
+
+// ParseBytes 解析人类可读的容量，比如 512m、1.5g、100kb，单位为 1024 进制，不带单位时表示字节数
+func ParseBytes(size string) (int64, error) {
+	str := strings.ToLower(strings.TrimSpace(size))
+	str = strings.TrimSuffix(str, "b")
+
+	var multiplier int64 = 1
+	if str != "" {
+		switch str[len(str)-1] {
+		case 'k':
+			multiplier = 1 << 10
+		case 'm':
+			multiplier = 1 << 20
+		case 'g':
+			multiplier = 1 << 30
+		case 't':
+			multiplier = 1 << 40
+		}
+		if multiplier != 1 {
+			str = str[:len(str)-1]
+		}
+	}
+
+	num, err := strconv.ParseFloat(str, 64)
+	if err != nil || num < 0 {
+		return 0, fmt.Errorf("invalid size: %q", size)
+	}
+	return int64(num * float64(multiplier)), nil
+}
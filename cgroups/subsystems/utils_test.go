@@ -0,0 +1,48 @@
+package subsystems
+
+import (
+	"gotest.tools/assert"
+	"strings"
+	"testing"
+)
+
+const testMountInfo = `24 30 0:22 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw
+32 24 0:28 / /sys/fs/cgroup rw,relatime - tmpfs tmpfs rw,mode=755
+33 32 0:29 / /sys/fs/cgroup/cpu,cpuacct rw,relatime shared:12 - cgroup cgroup rw,cpu,cpuacct
+36 32 0:32 / /sys/fs/cgroup/memory rw,relatime shared:15 - cgroup cgroup rw,memory
+42 32 0:38 / /sys/fs/cgroup/unified rw,relatime shared:9 - cgroup2 cgroup2 rw,nsdelegate`
+
+func TestFindMountPoint(t *testing.T) {
+	// cgroup v1 按子系统名查找
+	assert.Equal(t, "/sys/fs/cgroup/cpu,cpuacct", findMountPointBySubsystem(strings.NewReader(testMountInfo), "cpu"))
+	assert.Equal(t, "/sys/fs/cgroup/cpu,cpuacct", findMountPointBySubsystem(strings.NewReader(testMountInfo), "cpuacct"))
+	assert.Equal(t, "/sys/fs/cgroup/memory", findMountPointBySubsystem(strings.NewReader(testMountInfo), "memory"))
+	assert.Equal(t, "", findMountPointBySubsystem(strings.NewReader(testMountInfo), "pids"))
+
+	// cgroup v2 按文件系统类型查找
+	assert.Equal(t, "/sys/fs/cgroup/unified", findMountPointByFsType(strings.NewReader(testMountInfo), "cgroup2"))
+	assert.Equal(t, "", findMountPointByFsType(strings.NewReader(testMountInfo), "overlay"))
+}
+
+func TestParseBytes(t *testing.T) {
+	cases := map[string]int64{
+		"1024": 1024,
+		"100b": 100,
+		"10k":  10 << 10,
+		"10kb": 10 << 10,
+		"512m": 512 << 20,
+		"1.5g": 3 << 29,
+		"2GB":  2 << 30,
+		"1t":   1 << 40,
+	}
+	for size, expected := range cases {
+		n, err := ParseBytes(size)
+		assert.Equal(t, nil, err, size)
+		assert.Equal(t, expected, n, size)
+	}
+
+	for _, size := range []string{"", "m", "abc", "-1m", "10x"} {
+		_, err := ParseBytes(size)
+		assert.Assert(t, err != nil, size)
+	}
+}
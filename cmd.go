@@ -4,10 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"github.com/iverson3/xdocker/cgroups/subsystems"
+	"github.com/iverson3/xdocker/config"
+	"github.com/iverson3/xdocker/model"
 	"github.com/iverson3/xdocker/namespace"
 	"github.com/iverson3/xdocker/network"
 	"github.com/iverson3/xdocker/util"
+	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/iverson3/xdocker/command"
 	"github.com/urfave/cli"
@@ -23,120 +29,463 @@ var initCommand = cli.Command{
 		err := command.InitChildProcess()
 		if err != nil {
 			fmt.Println("ERROR: container.InitProcess() failed, error:", err)
+			// 容器进程没能运行用户命令时以非0退出码退出 (与 docker 一致)：找不到命令为 127，其他错误为 126
+			if errors.Is(err, exec.ErrNotFound) {
+				return cli.NewExitError("", 127)
+			}
+			return cli.NewExitError("", 126)
 		}
-		return err
+		return nil
+	},
+}
+
+var shimCommand = cli.Command{
+	Name:                   "shim",
+	Usage:                  "supervise a detached container as the parent of its init process",
+	Hidden:                 true,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "tty",
+			Usage:       "allocate a pseudo-TTY for the container",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		// 期望的命令格式： ./xdocker shim [-tty] containerName  (由 run/start 在后台启动)
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("missing container name")
+		}
+		return command.ShimContainer(ctx.Args().Get(0), ctx.Bool("tty"))
+	},
+}
+
+// run 和 create 共用的参数
+var containerFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:        "it",
+		Usage:       "open an interactive tty(pseudo terminal)",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "m",
+		Usage:       "limit the memory, e.g. 512m, -1 for unlimited",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "memory-swap",
+		Usage:       "total limit of memory plus swap, equal to -m to disable swap, -1 for unlimited swap",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "memory-reservation",
+		Usage:       "memory soft limit, e.g. 256m",
+		Required:    false,
+	},
+	&cli.Int64Flag{
+		Name:        "memory-swappiness",
+		Usage:       "tune memory swappiness, between 0 and 100",
+		Required:    false,
+	},
+	&cli.BoolFlag{
+		Name:        "oom-kill-disable",
+		Usage:       "disable the OOM killer",
+		Required:    false,
+	},
+	&cli.IntFlag{
+		Name:        "cpuper",
+		Usage:       "limit the cpu percentage",
+		Required:    false,
+	},
+	&cli.Float64Flag{
+		Name:        "cpus",
+		Usage:       "number of cpus, e.g. 1.5",
+		Required:    false,
+	},
+	&cli.IntFlag{
+		Name:        "cpushare",
+		Usage:       "cpu shares (relative weight)",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "cpuset-cpus",
+		Usage:       "cpus in which to allow execution, e.g. 0-3,5",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "cpuset-mems",
+		Usage:       "memory nodes in which to allow execution, e.g. 0-1",
+		Required:    false,
+	},
+	&cli.IntFlag{
+		Name:        "blkio-weight",
+		Usage:       "block io relative weight, between 10 and 1000",
+		Required:    false,
+	},
+	&cli.StringSliceFlag{
+		Name:        "device-read-bps",
+		Usage:       "limit read rate (bytes per second) from a device, e.g. /dev/sda:10mb",
+		Required:    false,
+	},
+	&cli.StringSliceFlag{
+		Name:        "device-write-bps",
+		Usage:       "limit write rate (bytes per second) to a device, e.g. /dev/sda:10mb",
+		Required:    false,
+	},
+	&cli.StringSliceFlag{
+		Name:        "device-read-iops",
+		Usage:       "limit read rate (IO per second) from a device, e.g. /dev/sda:1000",
+		Required:    false,
+	},
+	&cli.StringSliceFlag{
+		Name:        "device-write-iops",
+		Usage:       "limit write rate (IO per second) to a device, e.g. /dev/sda:1000",
+		Required:    false,
+	},
+	&cli.Int64Flag{
+		Name:        "pids-limit",
+		Usage:       "limit the number of processes, -1 for unlimited",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "v",
+		Usage:       "volume",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "name",
+		Usage:       "container name",
+		Required:    false,
+	},
+	&cli.StringSliceFlag{
+		Name:        "e",
+		Usage:       "set environment",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "net",
+		Usage:       "container network",
+		Required:    false,
+	},
+	&cli.StringSliceFlag{
+		Name:        "p",
+		Usage:       "port mapping",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "restart",
+		Usage:       "restart policy to apply when a container exits: no|on-failure[:N]|always|unless-stopped",
+		Value:       "no",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "stop-signal",
+		Usage:       "signal to stop the container, e.g. SIGTERM, SIGINT or 15",
+		Value:       model.DefaultStopSignal,
+		Required:    false,
+	},
+	&cli.IntFlag{
+		Name:        "stop-timeout",
+		Usage:       "seconds to wait for the container to stop before killing it",
+		Value:       model.DefaultStopTimeout,
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "w, workdir",
+		Usage:       "working directory inside the container, must be an absolute path",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "u, user",
+		Usage:       "username or uid, with an optional group: user[:group]",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "hostname",
+		Usage:       "container host name, defaults to the container ID",
+		Required:    false,
+	},
+	&cli.StringSliceFlag{
+		Name:        "dns",
+		Usage:       "set custom DNS servers, defaults to the ones in the host's resolv.conf",
+		Required:    false,
+	},
+	&cli.StringSliceFlag{
+		Name:        "dns-search",
+		Usage:       "set custom DNS search domains",
+		Required:    false,
+	},
+	&cli.StringSliceFlag{
+		Name:        "add-host",
+		Usage:       "add a custom host-to-IP mapping (host:ip)",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "shm-size",
+		Usage:       "size of /dev/shm, e.g. 128m (default 64m)",
+		Required:    false,
+	},
+	&cli.BoolFlag{
+		Name:        "init",
+		Usage:       "run an init inside the container that forwards signals and reaps processes",
+		Required:    false,
+	},
+	&cli.StringFlag{
+		Name:        "health-cmd",
+		Usage:       "command to run in the container to check its health",
+		Required:    false,
+	},
+	&cli.DurationFlag{
+		Name:        "health-interval",
+		Usage:       "time between running the health check, e.g. 30s",
+		Required:    false,
+	},
+	&cli.DurationFlag{
+		Name:        "health-timeout",
+		Usage:       "maximum time to allow one health check to run, e.g. 30s",
+		Required:    false,
+	},
+	&cli.DurationFlag{
+		Name:        "health-start-period",
+		Usage:       "start period for the container to initialize, failures during it are not counted",
+		Required:    false,
+	},
+	&cli.IntFlag{
+		Name:        "health-retries",
+		Usage:       "consecutive failures needed to report unhealthy",
+		Required:    false,
 	},
 }
 
 var runCommand = cli.Command{
 	Name:                   "run",
 	Usage:                  "Create a container with namespace and cgroups limit",
-	Flags:                  []cli.Flag{
-		&cli.BoolFlag{
-			Name:        "it",
-			Usage:       "open an interactive tty(pseudo terminal)",
-			Required:    false,
-		},
-		&cli.StringFlag{
-			Name:        "m",
-			Usage:       "limit the memory",
-			Required:    false,
-		},
-		//&cli.StringFlag{
-		//	Name:        "cpu",
-		//	//Usage:       "limit the cpu amount",
-		//	Usage:       "设置进程在指定的CPU上运行（参数为对应CPU的编号）",
-		//},
-		&cli.IntFlag{
-			Name:        "cpuper",
-			Usage:       "limit the cpu percentage",
-			Required:    false,
-		},
-		&cli.StringFlag{
-			Name:        "cpushare",
-			Usage:       "limit the cpu share",
-			Required:    false,
-		},
-		&cli.StringFlag{
-			Name:        "v",
-			Usage:       "volume",
-			Required:    false,
-		},
+	Flags:                  append([]cli.Flag{
 		&cli.BoolFlag{
 			Name:        "d",
 			Usage:       "detach container",
 			Required:    false,
 		},
-		&cli.StringFlag{
-			Name:        "name",
-			Usage:       "container name",
-			Required:    false,
-		},
-		&cli.StringSliceFlag{
-			Name:        "e",
-			Usage:       "set environment",
-			Required:    false,
-		},
-		&cli.StringFlag{
-			Name:        "net",
-			Usage:       "container network",
-			Required:    false,
-		},
-		&cli.StringSliceFlag{
-			Name:        "p",
-			Usage:       "port mapping",
-			Required:    false,
-		},
-	},
+	}, containerFlags...),
 	Action: func(ctx *cli.Context) error {
 		// 期望的命令格式： ./xdocker run [-name/-v/-d/-it/-m/-cpuper] imageName command
-		args := ctx.Args()
-		if len(args) < 2 {
-			return errors.New("missing image name or command")
+		opts, err := parseContainerOptions(ctx)
+		if err != nil {
+			return err
 		}
 
-		// 镜像名
-		imageName := args.Get(0)
-		// 检查镜像是否存在
-		exist, err := util.ImageIsExist(imageName)
+		// 检查是否有参数 "-d"
+		detach := ctx.Bool("d")
+		// 只有后台运行的容器才会被自动重启
+		policyName, _, _ := command.ParseRestartPolicy(opts.RestartPolicy)
+		if policyName != model.RestartPolicyNo && !detach {
+			return errors.New("restart policy can only be used with -d")
+		}
+
+		exitCode := command.Run(detach, opts)
+		if exitCode != 0 {
+			// 以容器的退出码退出，便于脚本判断容器中的命令是否执行成功
+			return cli.NewExitError("", exitCode)
+		}
+		return nil
+	},
+}
+
+var createCommand = cli.Command{
+	Name:                   "create",
+	Usage:                  "Create a new container without starting it",
+	Flags:                  containerFlags,
+	Action: func(ctx *cli.Context) error {
+		// 期望的命令格式： ./xdocker create [-name/-v/-it/-m/-cpuper] imageName command
+		opts, err := parseContainerOptions(ctx)
 		if err != nil {
 			return err
 		}
-		if !exist {
-			return errors.New("image not exist")
+		return command.CreateContainer(opts)
+	},
+}
+
+// 解析 run 和 create 共用的容器配置
+func parseContainerOptions(ctx *cli.Context) (*command.ContainerOptions, error) {
+	args := ctx.Args()
+	if len(args) < 2 {
+		return nil, errors.New("missing image name or command")
+	}
+
+	// 镜像名
+	imageName := args.Get(0)
+	// 检查镜像是否存在
+	exist, err := util.ImageIsExist(imageName)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, errors.New("image not exist")
+	}
+
+	// 收集容器命令
+	containerCmd := make([]string, len(args) - 1)
+	for index, cmd := range args[1:] {
+		containerCmd[index] = cmd
+	}
+
+	// 获取数据卷
+	volume := ctx.String("v")
+	// 环境变量
+	envSlice := ctx.StringSlice("e")
+	// 获取容器名
+	containerName := ctx.String("name")
+	// 容器网络
+	network := ctx.String("net")
+	// 端口映射
+	portMapping := ctx.StringSlice("p")
+	// 重启策略
+	restartPolicy := ctx.String("restart")
+	if _, _, err = command.ParseRestartPolicy(restartPolicy); err != nil {
+		return nil, err
+	}
+
+	// 停止容器时发送的信号和等待的时间，没有设置则在停止时使用默认值
+	stopSignal := ctx.String("stop-signal")
+	if _, err = command.ParseSignal(stopSignal); err != nil {
+		return nil, err
+	}
+	var stopTimeout *int
+	if ctx.IsSet("stop-timeout") {
+		timeout := ctx.Int("stop-timeout")
+		if timeout < 0 {
+			return nil, errors.New("stop timeout cannot be negative")
+		}
+		stopTimeout = &timeout
+	}
+
+	workingDir := ctx.String("w")
+	if workingDir != "" && !filepath.IsAbs(workingDir) {
+		return nil, errors.New("the working directory must be an absolute path")
+	}
+
+	healthcheck, err := parseHealthcheck(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname := ctx.String("hostname")
+	if len(hostname) > 64 || strings.ContainsAny(hostname, " \t/") {
+		return nil, fmt.Errorf("invalid hostname: %s", hostname)
+	}
+	dns := ctx.StringSlice("dns")
+	for _, server := range dns {
+		if net.ParseIP(server) == nil {
+			return nil, fmt.Errorf("invalid dns server: %s", server)
+		}
+	}
+	extraHosts := ctx.StringSlice("add-host")
+	for _, extraHost := range extraHosts {
+		kv := strings.SplitN(extraHost, ":", 2)
+		if len(kv) != 2 || kv[0] == "" || net.ParseIP(kv[1]) == nil {
+			return nil, fmt.Errorf("invalid add-host: %s, the format should be host:ip", extraHost)
 		}
+	}
 
-		// 收集容器命令
-		containerCmd := make([]string, len(args) - 1)
-		for index, cmd := range args[1:] {
-			containerCmd[index] = cmd
+	var shmSize int64 = model.DefaultShmSize
+	if ctx.IsSet("shm-size") {
+		if shmSize, err = subsystems.ParseBytes(ctx.String("shm-size")); err != nil {
+			return nil, err
+		}
+		if shmSize == 0 {
+			return nil, errors.New("the shm size must be greater than 0")
 		}
+	}
 
-		// 检查是否有参数 "-it"
-		tty := ctx.Bool("it")
-		// 检查是否有参数 "-d"
-		detach := ctx.Bool("d")
-		// 获取数据卷
-		volume := ctx.String("v")
-		// 环境变量
-		envSlice := ctx.StringSlice("e")
-		// 获取容器名
-		containerName := ctx.String("name")
-		// 容器网络
-		network := ctx.String("net")
-		// 端口映射
-		portMapping := ctx.StringSlice("p")
+	resourceConfig := &subsystems.ResourceConfig{
+		MemoryLimit: ctx.String("m"),
+		MemorySwap:  ctx.String("memory-swap"),
+		MemoryReservation: ctx.String("memory-reservation"),
+		CPUPercentage: ctx.Int("cpuper"),
+		CPUs:        ctx.Float64("cpus"),
+		CPUShare:    ctx.Int("cpushare"),
+		CpusetCpus:  ctx.String("cpuset-cpus"),
+		CpusetMems:  ctx.String("cpuset-mems"),
+		BlkioWeight: ctx.Int("blkio-weight"),
+		PidsLimit:   ctx.Int64("pids-limit"),
+	}
+	// swappiness 为 0 也是有意义的，所以只有用户设置了才填充
+	if ctx.IsSet("memory-swappiness") {
+		swappiness := ctx.Int64("memory-swappiness")
+		resourceConfig.MemorySwappiness = &swappiness
+	}
+	resourceConfig.OomKillDisable = ctx.Bool("oom-kill-disable")
+	// 没有指定内存限制和最大进程数则使用配置文件中的默认值
+	if !ctx.IsSet("m") {
+		resourceConfig.MemoryLimit = config.DefaultMemoryLimit
+	}
+	if !ctx.IsSet("pids-limit") {
+		resourceConfig.PidsLimit = config.DefaultPidsLimit
+	}
+	// 块设备的读写限速：设备路径需要解析为对应的主次设备号
+	if resourceConfig.BlkioDeviceReadBps, err = subsystems.ParseThrottleDevices(ctx.StringSlice("device-read-bps"), true); err != nil {
+		return nil, err
+	}
+	if resourceConfig.BlkioDeviceWriteBps, err = subsystems.ParseThrottleDevices(ctx.StringSlice("device-write-bps"), true); err != nil {
+		return nil, err
+	}
+	if resourceConfig.BlkioDeviceReadIOps, err = subsystems.ParseThrottleDevices(ctx.StringSlice("device-read-iops"), false); err != nil {
+		return nil, err
+	}
+	if resourceConfig.BlkioDeviceWriteIOps, err = subsystems.ParseThrottleDevices(ctx.StringSlice("device-write-iops"), false); err != nil {
+		return nil, err
+	}
+	if err = resourceConfig.Validate(); err != nil {
+		return nil, err
+	}
 
-		resourceConfig := &subsystems.ResourceConfig{
-			MemoryLimit: ctx.String("m"),
-			CPUPercentage: ctx.Int("cpuper"),
-			CPUShare:    ctx.String("cpushare"),
-			//CPUAmount:   ctx.String("cpu"),
+	return &command.ContainerOptions{
+		Image:         imageName,
+		Cmd:           containerCmd,
+		Name:          containerName,
+		Volume:        volume,
+		Env:           envSlice,
+		Network:       network,
+		PortMapping:   portMapping,
+		Resource:      resourceConfig,
+		RestartPolicy: restartPolicy,
+		StopSignal:    stopSignal,
+		StopTimeout:   stopTimeout,
+		Healthcheck:   healthcheck,
+		Init:          ctx.Bool("init"),
+		WorkingDir:    workingDir,
+		User:          ctx.String("u"),
+		Hostname:      hostname,
+		Dns:           dns,
+		DnsSearch:     ctx.StringSlice("dns-search"),
+		ExtraHosts:    extraHosts,
+		ShmSize:       shmSize,
+		Tty:           ctx.Bool("it"),
+	}, nil
+}
+
+// 解析健康检查的配置，没有指定 --health-cmd 时返回 nil
+func parseHealthcheck(ctx *cli.Context) (*model.HealthConfig, error) {
+	healthCmd := ctx.String("health-cmd")
+	if healthCmd == "" {
+		if ctx.IsSet("health-interval") || ctx.IsSet("health-timeout") || ctx.IsSet("health-start-period") || ctx.IsSet("health-retries") {
+			return nil, errors.New("health check options require --health-cmd")
 		}
+		return nil, nil
+	}
 
-		command.Run(tty, detach, containerCmd, resourceConfig, volume, imageName, containerName, envSlice, network, portMapping)
-		return nil
-	},
+	healthcheck := &model.HealthConfig{
+		Cmd:         healthCmd,
+		Interval:    ctx.Duration("health-interval"),
+		Timeout:     ctx.Duration("health-timeout"),
+		StartPeriod: ctx.Duration("health-start-period"),
+		Retries:     ctx.Int("health-retries"),
+	}
+	if healthcheck.Interval < 0 || healthcheck.Timeout < 0 || healthcheck.StartPeriod < 0 {
+		return nil, errors.New("health check durations cannot be negative")
+	}
+	if healthcheck.Retries < 0 {
+		return nil, errors.New("health check retries cannot be negative")
+	}
+	return healthcheck, nil
 }
 
 var listRemoteImageCommand = cli.Command{
@@ -256,6 +605,117 @@ var psCommand = cli.Command{
 	},
 }
 
+var statsCommand = cli.Command{
+	Name:                   "stats",
+	Usage:                  "display live resource usage of containers",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "no-stream",
+			Usage:       "print the first result only instead of refreshing every second",
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "format",
+			Usage:       "output format: table or json",
+			Value:       "table",
+			Required:    false,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		// 不指定容器则输出所有运行中的容器
+		containers := []string(ctx.Args())
+		return command.StatsContainers(containers, ctx.Bool("no-stream"), ctx.String("format"))
+	},
+}
+
+var updateCommand = cli.Command{
+	Name:                   "update",
+	Usage:                  "update resource limits of a container",
+	Flags:                  []cli.Flag{
+		&cli.StringFlag{
+			Name:        "m",
+			Usage:       "limit the memory, e.g. 512m, -1 for unlimited",
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "memory-swap",
+			Usage:       "total limit of memory plus swap, equal to -m to disable swap, -1 for unlimited swap",
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "memory-reservation",
+			Usage:       "memory soft limit, e.g. 256m",
+			Required:    false,
+		},
+		&cli.Int64Flag{
+			Name:        "memory-swappiness",
+			Usage:       "tune memory swappiness, between 0 and 100",
+			Required:    false,
+		},
+		&cli.IntFlag{
+			Name:        "cpuper",
+			Usage:       "limit the cpu percentage, -1 for unlimited",
+			Required:    false,
+		},
+		&cli.Float64Flag{
+			Name:        "cpus",
+			Usage:       "number of cpus, e.g. 1.5",
+			Required:    false,
+		},
+		&cli.IntFlag{
+			Name:        "cpushare",
+			Usage:       "cpu shares (relative weight)",
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "cpuset-cpus",
+			Usage:       "cpus in which to allow execution, e.g. 0-3,5",
+			Required:    false,
+		},
+		&cli.StringFlag{
+			Name:        "cpuset-mems",
+			Usage:       "memory nodes in which to allow execution, e.g. 0-1",
+			Required:    false,
+		},
+		&cli.IntFlag{
+			Name:        "blkio-weight",
+			Usage:       "block io relative weight, between 10 and 1000",
+			Required:    false,
+		},
+		&cli.Int64Flag{
+			Name:        "pids-limit",
+			Usage:       "limit the number of processes, -1 for unlimited",
+			Required:    false,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		// 期望的命令格式： ./xdocker update [-m/-cpuper/-cpus/...] containerName
+		if len(ctx.Args()) < 1 {
+			return errors.New("missing container name or container id")
+		}
+
+		// 只有用户设置了的限制才会被修改，其他的限制保持不变
+		resourceConfig := &subsystems.ResourceConfig{
+			MemoryLimit: ctx.String("m"),
+			MemorySwap:  ctx.String("memory-swap"),
+			MemoryReservation: ctx.String("memory-reservation"),
+			CPUPercentage: ctx.Int("cpuper"),
+			CPUs:        ctx.Float64("cpus"),
+			CPUShare:    ctx.Int("cpushare"),
+			CpusetCpus:  ctx.String("cpuset-cpus"),
+			CpusetMems:  ctx.String("cpuset-mems"),
+			BlkioWeight: ctx.Int("blkio-weight"),
+			PidsLimit:   ctx.Int64("pids-limit"),
+		}
+		// swappiness 为 0 也是有意义的，所以只有用户设置了才填充
+		if ctx.IsSet("memory-swappiness") {
+			swappiness := ctx.Int64("memory-swappiness")
+			resourceConfig.MemorySwappiness = &swappiness
+		}
+		return command.UpdateContainer(ctx.Args().Get(0), resourceConfig)
+	},
+}
+
 var imagesCommand = cli.Command{
 	Name:                   "images",
 	Usage:                  "list all images local",
@@ -389,6 +849,45 @@ var execCommand = cli.Command{
 	},
 }
 
+// 输出容器的事件
+var eventsCommand = cli.Command{
+	Name:                   "events",
+	Usage:                  "print events of containers",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "f",
+			Usage:       "keep printing new events",
+			Required:    false,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		// 不指定容器则输出所有容器的事件
+		return command.ListEvents(ctx.Args().Get(0), ctx.Bool("f"))
+	},
+}
+
+var restoreCommand = cli.Command{
+	Name:                   "restore",
+	Usage:                  "start containers according to their restart policies after a host reboot",
+	Action: func(ctx *cli.Context) error {
+		return command.RestoreContainers()
+	},
+}
+
+var systemCommand = cli.Command{
+	Name:                   "system",
+	Usage:                  "manage xdocker",
+	Subcommands: []cli.Command {
+		{
+			Name: "reconcile",
+			Usage: "fix up container states, mounts, cgroups and ip allocations that no longer match the host",
+			Action: func(ctx *cli.Context) error {
+				return command.ReconcileSystem()
+			},
+		},
+	},
+}
+
 // 暂停容器的运行
 var pauseCommand = cli.Command{
 	Name:                   "pause",
@@ -422,14 +921,95 @@ var continueCommand = cli.Command{
 var stopCommand = cli.Command{
 	Name:                   "stop",
 	Usage:                  "stop a container",
+	Flags:                  []cli.Flag{
+		&cli.IntFlag{
+			Name:        "t",
+			Usage:       "seconds to wait for the container to stop before killing it, defaults to the container's stop timeout",
+			Required:    false,
+		},
+	},
 	Action: func(ctx *cli.Context) error {
 		args := ctx.Args()
 		if len(args) == 0 {
 			return fmt.Errorf("missing container name or container id")
 		}
 
+		// 没有指定 -t 时使用容器的 stop-timeout
+		timeout := -1
+		if ctx.IsSet("t") {
+			timeout = ctx.Int("t")
+			if timeout < 0 {
+				return fmt.Errorf("timeout cannot be negative")
+			}
+		}
 		container := args.Get(0)
-		return command.StopContainer(container)
+		return command.StopContainer(container, timeout)
+	},
+}
+
+var killCommand = cli.Command{
+	Name:                   "kill",
+	Usage:                  "send a signal to one or more running containers",
+	Flags:                  []cli.Flag{
+		&cli.StringFlag{
+			Name:        "s",
+			Usage:       "signal to send to the container, e.g. SIGHUP, HUP or 1",
+			Value:       "SIGKILL",
+			Required:    false,
+		},
+		&cli.BoolFlag{
+			Name:        "all",
+			Usage:       "send the signal to all processes in the container instead of only the init process",
+			Required:    false,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		// 期望的命令格式： ./xdocker kill [-s SIGNAL] [--all] 容器ID/容器名 [容器ID/容器名...]
+		args := ctx.Args()
+		if len(args) == 0 {
+			return fmt.Errorf("missing container name or container id")
+		}
+		return command.KillContainers(args, ctx.String("s"), ctx.Bool("all"))
+	},
+}
+
+var waitCommand = cli.Command{
+	Name:                   "wait",
+	Usage:                  "block until one or more containers stop, then print their exit codes",
+	Action: func(ctx *cli.Context) error {
+		// 期望的命令格式： ./xdocker wait 容器ID/容器名 [容器ID/容器名...]
+		args := ctx.Args()
+		if len(args) == 0 {
+			return fmt.Errorf("missing container name or container id")
+		}
+		return command.WaitContainers(args)
+	},
+}
+
+var attachCommand = cli.Command{
+	Name:                   "attach",
+	Usage:                  "attach local standard input and output to a running container started with -it",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "detach-keys",
+			Usage:       "key sequence for detaching from the container, e.g. ctrl-a,x",
+			Value:       "ctrl-p,ctrl-q",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		// 期望的命令格式： ./xdocker attach [-detach-keys ctrl-p,ctrl-q] 容器ID/容器名
+		if len(ctx.Args()) == 0 {
+			return fmt.Errorf("missing container name or container id")
+		}
+		exitCode, err := command.AttachContainer(ctx.Args().Get(0), ctx.String("detach-keys"))
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			// 与 docker 一致，以容器的退出码退出
+			return cli.NewExitError("", exitCode)
+		}
+		return nil
 	},
 }
 
@@ -450,14 +1030,29 @@ var startCommand = cli.Command{
 var restartCommand = cli.Command{
 	Name:                   "restart",
 	Usage:                  "restart a container",
+	Flags:                  []cli.Flag{
+		&cli.IntFlag{
+			Name:        "t",
+			Usage:       "seconds to wait for the container to stop before killing it, defaults to the container's stop timeout",
+			Required:    false,
+		},
+	},
 	Action: func(ctx *cli.Context) error {
 		args := ctx.Args()
 		if len(args) == 0 {
 			return fmt.Errorf("missing container name or container id")
 		}
 
+		// 没有指定 -t 时使用容器的 stop-timeout
+		timeout := -1
+		if ctx.IsSet("t") {
+			timeout = ctx.Int("t")
+			if timeout < 0 {
+				return fmt.Errorf("timeout cannot be negative")
+			}
+		}
 		container := args.Get(0)
-		return command.ReStartContainer(container)
+		return command.ReStartContainer(container, timeout)
 	},
 }
 
@@ -0,0 +1,244 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/iverson3/xdocker/model"
+	"github.com/iverson3/xdocker/util"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// 默认的 detach keys (与 docker 一致)
+const defaultDetachKeys = "ctrl-p,ctrl-q"
+
+// 输入中出现了 detach keys
+var errDetached = errors.New("detached")
+
+// AttachContainer 将当前终端连接到容器的终端，返回容器的退出码 (按下 detach keys 脱离容器时返回0)
+func AttachContainer(containerFlag, detachKeys string) (int, error) {
+	exists, containerName, err := util.ContainerIsExists(containerFlag)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("container not exists: %s", containerFlag)
+	}
+
+	exitCode, _, err := attachContainer(containerName, detachKeys)
+	return exitCode, err
+}
+
+// attachContainer 通过 shim 的控制socket连接到容器的终端，直到容器进程退出或者输入中出现了 detach keys
+func attachContainer(containerName, detachKeys string) (exitCode int, detached bool, err error) {
+	keys, err := parseDetachKeys(detachKeys)
+	if err != nil {
+		return 0, false, err
+	}
+	info, err := util.GetContainerInfoByName(containerName)
+	if err != nil {
+		return 0, false, err
+	}
+	if !info.Tty {
+		return 0, false, fmt.Errorf("container %s was not started with a tty, use xdocker logs to see its output", containerName)
+	}
+	if info.Status != model.RUNNING && info.Status != model.PAUSED {
+		return 0, false, fmt.Errorf("container %s is not running", containerName)
+	}
+
+	conn, output, err := dialAttach(containerName)
+	if err != nil {
+		return 0, false, err
+	}
+	return streamAttach(containerName, conn, output, keys)
+}
+
+// dialAttach 向 shim 发送 attach 请求，返回的连接之后就是容器终端的输入输出
+func dialAttach(containerName string) (net.Conn, io.Reader, error) {
+	conn, err := dialShim(containerName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to container shim failed, error: %v", err)
+	}
+	if err = json.NewEncoder(conn).Encode(&model.ShimRequest{Action: model.ShimActionAttach}); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	decoder := json.NewDecoder(conn)
+	var resp model.ShimResponse
+	if err = decoder.Decode(&resp); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if resp.Error != "" {
+		conn.Close()
+		return nil, nil, errors.New(resp.Error)
+	}
+	// decoder 可能已经读取了响应之后的终端输出，去掉响应末尾的换行符
+	buffered, _ := ioutil.ReadAll(decoder.Buffered())
+	buffered = bytes.TrimPrefix(buffered, []byte("\n"))
+	return conn, io.MultiReader(bytes.NewReader(buffered), conn), nil
+}
+
+// streamAttach 在当前终端和容器终端之间转发输入输出，返回时关闭连接
+// 当前进程的标准输入是终端时将其切换为 raw 模式，所有按键 (包括 Ctrl-C) 都原样交给容器中的进程处理
+func streamAttach(containerName string, conn net.Conn, output io.Reader, keys []byte) (exitCode int, detached bool, err error) {
+	defer conn.Close()
+
+	stdinFd := os.Stdin.Fd()
+	if util.IsTerminal(stdinFd) {
+		state, err := util.MakeRaw(stdinFd)
+		if err != nil {
+			return 0, false, err
+		}
+		defer util.RestoreTerminal(stdinFd, state)
+
+		// 同步终端的大小，之后终端大小变化时再次同步
+		resizeContainer(containerName, stdinFd)
+		winch := make(chan os.Signal, 1)
+		signal.Notify(winch, syscall.SIGWINCH)
+		defer signal.Stop(winch)
+		go func() {
+			for range winch {
+				resizeContainer(containerName, stdinFd)
+			}
+		}()
+	}
+
+	outputDone := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(os.Stdout, output)
+		close(outputDone)
+	}()
+	inputDetached := make(chan struct{})
+	go func() {
+		_, err := io.Copy(conn, newDetachReader(os.Stdin, keys))
+		if err == errDetached {
+			close(inputDetached)
+		}
+	}()
+
+	select {
+	case <-inputDetached:
+		return 0, true, nil
+	case <-outputDone:
+	}
+
+	// shim 在记录容器的退出状态之后才会断开连接
+	info, err := util.GetContainerInfoByName(containerName)
+	if err != nil {
+		return 0, false, err
+	}
+	return info.ExitCode, false, nil
+}
+
+// 将当前终端的大小同步给容器的终端
+func resizeContainer(containerName string, fd uintptr) {
+	width, height, err := util.GetWinsize(fd)
+	if err != nil {
+		return
+	}
+	conn, err := dialShim(containerName)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_ = sendShimRequest(conn, &model.ShimRequest{
+		Action: model.ShimActionResize,
+		Width:  width,
+		Height: height,
+	})
+}
+
+// parseDetachKeys 解析 detach keys，格式为逗号分隔的按键，每个按键是单个字符或者 ctrl-<value>
+// value 为 a-z、@、[、\、]、^、_ 之一 (与 docker 一致)
+func parseDetachKeys(keys string) ([]byte, error) {
+	if keys == "" {
+		keys = defaultDetachKeys
+	}
+	var seq []byte
+	for _, key := range strings.Split(keys, ",") {
+		switch {
+		case len(key) == 1:
+			seq = append(seq, key[0])
+		case len(key) == 6 && strings.HasPrefix(strings.ToLower(key), "ctrl-"):
+			c := key[5]
+			switch {
+			case c >= 'a' && c <= 'z':
+				seq = append(seq, c-'a'+1)
+			case c >= 'A' && c <= 'Z':
+				seq = append(seq, c-'A'+1)
+			case c == '@':
+				seq = append(seq, 0)
+			case c >= '[' && c <= '_':
+				// [ \ ] ^ _ 依次为 27-31
+				seq = append(seq, c-'['+27)
+			default:
+				return nil, fmt.Errorf("invalid detach keys: %s", keys)
+			}
+		default:
+			return nil, fmt.Errorf("invalid detach keys: %s", keys)
+		}
+	}
+	return seq, nil
+}
+
+// detachReader 从输入中过滤 detach keys，读到完整的 detach keys 时返回 errDetached
+// 只匹配了一部分的按键先保留下来，后续的输入不匹配时再原样交给容器
+type detachReader struct {
+	r       io.Reader
+	keys    []byte
+	matched int
+	pending []byte
+	err     error
+}
+
+func newDetachReader(r io.Reader, keys []byte) io.Reader {
+	if len(keys) == 0 {
+		return r
+	}
+	return &detachReader{r: r, keys: keys}
+}
+
+func (d *detachReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 && d.err == nil {
+		buf := make([]byte, len(p))
+		n, err := d.r.Read(buf)
+		for _, b := range buf[:n] {
+			if b == d.keys[d.matched] {
+				d.matched++
+				if d.matched == len(d.keys) {
+					err = errDetached
+					break
+				}
+				continue
+			}
+			d.pending = append(d.pending, d.keys[:d.matched]...)
+			d.matched = 0
+			if b == d.keys[0] {
+				d.matched = 1
+			} else {
+				d.pending = append(d.pending, b)
+			}
+		}
+		if err != nil && err != errDetached {
+			// 输入结束时保留的按键也要交给容器
+			d.pending = append(d.pending, d.keys[:d.matched]...)
+			d.matched = 0
+		}
+		d.err = err
+	}
+
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	if len(d.pending) == 0 {
+		return n, d.err
+	}
+	return n, nil
+}
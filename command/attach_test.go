@@ -0,0 +1,43 @@
+package command
+
+import (
+	"gotest.tools/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParseDetachKeys(t *testing.T) {
+	keys, err := parseDetachKeys("")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []byte{16, 17}, keys)
+
+	keys, err = parseDetachKeys("ctrl-a,x,ctrl-@,ctrl-_")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []byte{1, 'x', 0, 31}, keys)
+
+	for _, spec := range []string{"ctrl-1", "ctrl-", "ab", "ctrl-p,,ctrl-q"} {
+		_, err = parseDetachKeys(spec)
+		assert.Assert(t, err != nil, spec)
+	}
+}
+
+func TestDetachReader(t *testing.T) {
+	keys := []byte{16, 17}
+
+	// detach keys 之前的输入原样交给容器，之后的输入被丢弃
+	data, err := ioutil.ReadAll(newDetachReader(strings.NewReader("ls\r\x10\x11echo"), keys))
+	assert.Equal(t, errDetached, err)
+	assert.Equal(t, "ls\r", string(data))
+
+	// 只匹配了一部分时原样交给容器
+	data, err = ioutil.ReadAll(newDetachReader(strings.NewReader("a\x10b\x10\x10"), keys))
+	assert.NilError(t, err)
+	assert.Equal(t, "a\x10b\x10\x10", string(data))
+
+	// 按键分多次读到
+	data, err = ioutil.ReadAll(newDetachReader(iotest.OneByteReader(strings.NewReader("x\x10\x11")), keys))
+	assert.Equal(t, errDetached, err)
+	assert.Equal(t, "x", string(data))
+}
@@ -190,27 +190,6 @@ func (dc *DockerfileFromCmd) Exec(buildCtx *BuildContext, cmdLine []string) (err
 	// 更新当前的容器ID
 	buildCtx.CurContainerId = containerId
 
-	// 为容器配置dns，确保容器内能够解析域名 (默认容器内是没法解析域名的，因为没有配置dns服务ip)
-	// 判断是否存在 /etc/resolv.conf 文件
-	dnsFileName := "resolv.conf"
-	cmd = fmt.Sprintf(`xdocker exec %s`, buildCtx.CurContainerId)
-	grepRes, err := util.RunCommand(cmd, fmt.Sprintf("ls /etc/ | grep %s", dnsFileName))
-	if err != nil {
-		return err
-	}
-	if grepRes == "" || grepRes == "\n" || grepRes[:len(grepRes) - 1] != dnsFileName {
-		// 文件不存在则创建
-		_, err = util.RunCommand(cmd, fmt.Sprintf("touch /etc/%s", dnsFileName))
-		if err != nil {
-			return err
-		}
-	}
-	// 在文件中写入一行 nameserver 8.8.8.8  (以追加的方式写入内容)
-	_, err = util.RunCommand(cmd, fmt.Sprintf(`echo "nameserver 8.8.8.8" >> /etc/%s`, dnsFileName))
-	if err != nil {
-		return err
-	}
-
 	// 设置容器的挂载信息
 	m := make(map[string]string)
 	m[buildCtx.ContextDir] = defaultMountPoint
@@ -720,13 +699,6 @@ func parseDockerfileCommand(contextDir string, cmdLines [][]string) (*BuildConte
 		fmt.Println("===========================complete=============================")
 	}
 
-	// 额外再执行一个命令，创建 /dev/null 文件
-	cmd := fmt.Sprintf(`xdocker exec %s`, buildCtx.CurContainerId)
-	_, err := util.RunCommand(cmd, "touch /dev/null")
-	if err != nil {
-		fmt.Println("Build: touch /dev/null failed: ", err)
-	}
-
 	fmt.Println(buildCtx.ContainerMap)
 	fmt.Println("build success")
 	return buildCtx, nil
@@ -4,18 +4,19 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+	"github.com/iverson3/xdocker/container"
 	"github.com/iverson3/xdocker/model"
 	"github.com/iverson3/xdocker/util"
 )
 
 // CommitContainer 将容器打包为镜像，存储到xdocker的镜像目录下
-func CommitContainer(container, tag string) error {
-	exists, containerName, err := util.ContainerIsExists(container)
+func CommitContainer(containerFlag, tag string) error {
+	exists, containerName, err := util.ContainerIsExists(containerFlag)
 	if err != nil {
 		return err
 	}
 	if !exists {
-		return fmt.Errorf("container not exists: %s", container)
+		return fmt.Errorf("container not exists: %s", containerFlag)
 	}
 
 	containerInfo, err := util.GetContainerInfoByName(containerName)
@@ -50,7 +51,12 @@ func CommitContainer(container, tag string) error {
 		return fmt.Errorf("duplicate image tag")
 	}
 
-	_, err = exec.Command("tar", "-czf", imageTarUrl, "-C", mntUrl, ".").CombinedOutput()
+	// 排除为绑定挂载 etc 文件而创建的空占位文件
+	tarArgs := []string{"-czf", imageTarUrl, "-C", mntUrl, "--anchored"}
+	for _, placeholder := range container.EtcFilePlaceholders(rootUrl, containerInfo.Image) {
+		tarArgs = append(tarArgs, "--exclude="+placeholder)
+	}
+	_, err = exec.Command("tar", append(tarArgs, ".")...).CombinedOutput()
 	if err != nil {
 		fmt.Println(fmt.Errorf("CommitContainer: tar container failed, error: %v", err))
 		return err
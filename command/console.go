@@ -0,0 +1,227 @@
+package command
+
+import (
+	"fmt"
+	"github.com/iverson3/xdocker/container"
+	"github.com/iverson3/xdocker/util"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// 容器进程退出之后等待终端中剩余输出的最长时间
+const consoleDrainTimeout = time.Second
+
+// 每个 attach 的客户端最多积压的输出块数，超过之后断开该客户端
+const consoleClientQueueSize = 64
+
+// consoleRelay 在 shim 中转发容器的终端：终端的输出写入日志文件和所有 attach 的客户端，客户端的输入写入终端
+// 每个容器进程一个，终端由容器的 init 进程分配并通过 console socket 发送过来，收到之前 attach 的客户端和调整的大小先保留下来
+// 容器进程 (以及容器中所有持有终端的进程) 退出之后读取 master 端会得到 EIO，转发随之结束
+// 每个客户端的输出由各自的 goroutine 发送，暂停或者网络很慢的客户端不会阻塞终端的输出和其它客户端，积压太多时会被断开
+type consoleRelay struct {
+	log     io.Writer
+	mu      sync.Mutex
+	console *os.File // 收到终端之前为 nil
+	width   uint16   // 收到终端之前调整的大小
+	height  uint16
+	clients map[net.Conn]chan []byte // 客户端和它待发送的输出
+	ready   chan struct{}            // 接收终端结束 (收到终端或者 init 进程没有发送就退出了) 或者转发被关闭时关闭
+	once    sync.Once
+	done    chan struct{} // 终端的输出转发结束时关闭
+}
+
+func newConsoleRelay(log io.Writer) *consoleRelay {
+	return &consoleRelay{
+		log:     log,
+		clients: make(map[net.Conn]chan []byte),
+		ready:   make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// receive 等待容器的 init 进程通过 console socket 发送终端，之后开始转发终端的输出
+func (r *consoleRelay) receive(socket *os.File) {
+	console, err := container.RecvConsole(socket)
+	socket.Close()
+
+	r.mu.Lock()
+	if err == nil {
+		if r.clients == nil {
+			// 转发已经被关闭了
+			console.Close()
+			console = nil
+		} else {
+			r.console = console
+			if r.width > 0 && r.height > 0 {
+				_ = r.resize(r.width, r.height)
+			}
+		}
+	}
+	r.mu.Unlock()
+	r.once.Do(func() { close(r.ready) })
+
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if console != nil {
+		r.run()
+	}
+}
+
+func (r *consoleRelay) run() {
+	defer close(r.done)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.console.Read(buf)
+		if n > 0 {
+			if r.log != nil {
+				_, _ = r.log.Write(buf[:n])
+			}
+			// buf 会被下一次读取覆盖，客户端的 goroutine 需要一份自己的数据
+			r.broadcast(append([]byte(nil), buf[:n]...))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// 将输出放入所有 attach 的客户端的发送队列，队列已满的客户端跟不上输出，直接断开
+func (r *consoleRelay) broadcast(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for conn, out := range r.clients {
+		select {
+		case out <- p:
+		default:
+			r.removeClient(conn)
+		}
+	}
+}
+
+// 将发送队列中的输出写给客户端，发送队列关闭或者写入失败时关闭连接，Attach 随之结束
+func sendToClient(conn net.Conn, out <-chan []byte) {
+	defer conn.Close()
+	for p := range out {
+		if _, err := conn.Write(p); err != nil {
+			return
+		}
+	}
+}
+
+// 断开客户端并结束它的发送，调用方需要持有 r.mu
+func (r *consoleRelay) removeClient(conn net.Conn) {
+	out, ok := r.clients[conn]
+	if !ok {
+		return
+	}
+	conn.Close()
+	close(out)
+	delete(r.clients, conn)
+}
+
+// Attach 将客户端的输入写入终端，直到客户端断开连接或者转发被关闭
+// 还没有收到终端时先等待，客户端不会错过容器一开始的输出
+func (r *consoleRelay) Attach(conn net.Conn) {
+	r.mu.Lock()
+	if r.clients == nil {
+		r.mu.Unlock()
+		return
+	}
+	out := make(chan []byte, consoleClientQueueSize)
+	r.clients[conn] = out
+	r.mu.Unlock()
+	go sendToClient(conn, out)
+
+	<-r.ready
+	r.mu.Lock()
+	console := r.console
+	r.mu.Unlock()
+	if console != nil {
+		_, _ = io.Copy(console, conn)
+	}
+
+	r.mu.Lock()
+	if r.clients != nil {
+		r.removeClient(conn)
+	}
+	r.mu.Unlock()
+}
+
+// Resize 调整容器终端的大小，内核会给终端的前台进程组发送 SIGWINCH
+// 还没有收到终端时记录下来，收到之后再调整
+func (r *consoleRelay) Resize(width, height uint16) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.console == nil {
+		r.width, r.height = width, height
+		return nil
+	}
+	return r.resize(width, height)
+}
+
+func (r *consoleRelay) resize(width, height uint16) error {
+	// 不能使用 Fd()，它会将文件切换为阻塞模式，之后关闭 master 端时无法打断正在进行的读取
+	rawConn, err := r.console.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var resizeErr error
+	err = rawConn.Control(func(fd uintptr) {
+		resizeErr = util.SetWinsize(fd, width, height)
+	})
+	if err != nil {
+		return err
+	}
+	return resizeErr
+}
+
+// Drain 容器进程退出之后等待终端中剩余的输出转发完成
+// 很快退出的容器进程发送的终端可能还没有被接收，先等待接收结束；容器中可能还有进程持有终端，所以总共最多只等待 consoleDrainTimeout
+func (r *consoleRelay) Drain() {
+	if r == nil {
+		return
+	}
+	timeout := time.After(consoleDrainTimeout)
+	select {
+	case <-r.ready:
+	case <-timeout:
+		return
+	}
+	r.mu.Lock()
+	received := r.console != nil
+	r.mu.Unlock()
+	if !received {
+		return
+	}
+	select {
+	case <-r.done:
+	case <-timeout:
+	}
+}
+
+// Close 关闭终端并断开所有 attach 的客户端
+func (r *consoleRelay) Close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.clients == nil {
+		return
+	}
+	// 发送完队列中剩余的输出再断开客户端，不能被停滞的客户端一直阻塞
+	for conn, out := range r.clients {
+		_ = conn.SetWriteDeadline(time.Now().Add(consoleDrainTimeout))
+		close(out)
+	}
+	r.clients = nil
+	if r.console != nil {
+		r.console.Close()
+	}
+	r.once.Do(func() { close(r.ready) })
+}
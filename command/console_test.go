@@ -0,0 +1,50 @@
+package command
+
+import (
+	"fmt"
+	"gotest.tools/assert"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConsoleRelayBroadcast(t *testing.T) {
+	r := newConsoleRelay(nil)
+	stalled, stalledPeer := net.Pipe()
+	defer stalledPeer.Close()
+	reader, readerPeer := net.Pipe()
+	defer readerPeer.Close()
+	go r.Attach(stalled)
+	go r.Attach(reader)
+	deadline := time.Now().Add(5 * time.Second)
+	for clientCount(r) != 2 {
+		assert.Assert(t, time.Now().Before(deadline), "clients were not attached")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 不读取输出的客户端不会阻塞输出和其他客户端，积压太多之后被断开
+	for i := 0; i < consoleClientQueueSize+2; i++ {
+		p := []byte(fmt.Sprintf("line %d\n", i))
+		r.broadcast(p)
+		buf := make([]byte, len(p))
+		_, err := io.ReadFull(readerPeer, buf)
+		assert.NilError(t, err)
+		assert.Equal(t, string(p), string(buf))
+	}
+	assert.Equal(t, 1, clientCount(r))
+
+	// 关闭时先发送完队列中剩余的输出再断开客户端
+	r.broadcast([]byte("exit\n"))
+	r.Close()
+	data, err := ioutil.ReadAll(readerPeer)
+	assert.NilError(t, err)
+	assert.Equal(t, "exit\n", string(data))
+}
+
+func clientCount(r *consoleRelay) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.clients)
+}
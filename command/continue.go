@@ -4,10 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"strconv"
+	"github.com/iverson3/xdocker/cgroups"
 	"github.com/iverson3/xdocker/model"
 	"github.com/iverson3/xdocker/util"
-	"syscall"
 )
 
 // RecoverContainer 恢复一个已暂停的容器，让其继续运行
@@ -30,15 +29,11 @@ func RecoverContainer(containerFlag string) error {
 		return fmt.Errorf("container not be paused")
 	}
 
-	pid, err := strconv.Atoi(info.Pid)
+	// 解冻容器cgroup中的所有进程，并等待解冻完成
+	cm := cgroups.NewCgroupManager(fmt.Sprintf(model.DefaultCgroupPath, info.ID))
+	err = cm.Thaw()
 	if err != nil {
-		return err
-	}
-
-	// 使用"kill -CONT"命令恢复容器进程的运行
-	err = syscall.Kill(pid, syscall.SIGCONT)
-	if err != nil {
-		return err
+		return fmt.Errorf("thaw container failed, error: %v", err)
 	}
 
 	// 更新容器的状态
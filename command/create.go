@@ -0,0 +1,232 @@
+package command
+
+import (
+	"fmt"
+	"github.com/iverson3/xdocker/cgroups"
+	"github.com/iverson3/xdocker/cgroups/subsystems"
+	"github.com/iverson3/xdocker/container"
+	"github.com/iverson3/xdocker/model"
+	"github.com/iverson3/xdocker/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 容器进程默认的 PATH 环境变量
+const defaultPathEnv = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// ContainerOptions 用户创建容器时指定的配置，run 和 create 共用
+type ContainerOptions struct {
+	Image         string
+	Cmd           []string
+	Name          string
+	Volume        string
+	Env           []string
+	Network       string
+	PortMapping   []string
+	Resource      *subsystems.ResourceConfig
+	RestartPolicy string
+	StopSignal    string
+	StopTimeout   *int
+	Healthcheck   *model.HealthConfig
+	Init          bool
+	WorkingDir    string
+	User          string
+	Hostname      string
+	Dns           []string
+	DnsSearch     []string
+	ExtraHosts    []string
+	ShmSize       int64
+	Tty           bool
+}
+
+// 根据用户指定的配置生成容器信息，运行时的信息 (比如Pid、IP地址) 由调用方填充
+func (o *ContainerOptions) containerInfo(containerId, containerName string) *model.ContainerInfo {
+	// 没有指定主机名时使用容器ID (与 docker 一致)
+	hostname := o.Hostname
+	if hostname == "" {
+		hostname = containerId
+	}
+	return &model.ContainerInfo{
+		ID:             containerId,
+		Name:           containerName,
+		Image:          o.Image,
+		Command:        strings.Join(o.Cmd, " "),
+		Args:           o.Cmd,
+		Env:            o.Env,
+		Init:           o.Init,
+		WorkingDir:     o.WorkingDir,
+		User:           o.User,
+		Hostname:       hostname,
+		Dns:            o.Dns,
+		DnsSearch:      o.DnsSearch,
+		ExtraHosts:     o.ExtraHosts,
+		ShmSize:        o.ShmSize,
+		Tty:            o.Tty,
+		Volume:         o.Volume,
+		NetworkName:    o.Network,
+		PortMapping:    o.PortMapping,
+		ResourceConfig: o.Resource,
+		RestartPolicy:  o.RestartPolicy,
+		StopSignal:     o.StopSignal,
+		StopTimeout:    o.StopTimeout,
+		Healthcheck:    o.Healthcheck,
+	}
+}
+
+// 根据容器信息生成容器 init 进程的配置，run、start 和自动重启都以此创建完全相同的容器进程
+func initConfigOf(info *model.ContainerInfo) *model.InitConfig {
+	// 旧版本创建的容器没有记录命令参数，只能按空格拆分命令
+	args := info.Args
+	if len(args) == 0 {
+		args = strings.Split(info.Command, " ")
+	}
+	return &model.InitConfig{
+		Args:     args,
+		Env:      containerEnv(info),
+		Cwd:      info.WorkingDir,
+		User:     info.User,
+		Hostname: info.Hostname,
+		Init:     info.Init,
+		ShmSize:  info.ShmSize,
+		Tty:      info.Tty,
+	}
+}
+
+// containerEnv 生成容器进程的环境变量：固定的默认值 (与 docker 一致) 加上用户设置的环境变量
+// 不继承 xdocker 自身的环境变量，否则容器每次启动的环境取决于启动它的进程 (shell、shim 或 systemd)，还会把宿主机的变量带进容器
+// 用户设置的同名变量替换默认值，而不是追加在后面 (getenv 以第一个出现的为准)
+func containerEnv(info *model.ContainerInfo) []string {
+	env := []string{"PATH=" + defaultPathEnv}
+	if info.Hostname != "" {
+		env = append(env, "HOSTNAME="+info.Hostname)
+	}
+	if info.Tty {
+		env = append(env, "TERM=xterm")
+	}
+	for _, kv := range info.Env {
+		key := strings.SplitN(kv, "=", 2)[0]
+		replaced := false
+		for i := range env {
+			if strings.SplitN(env[i], "=", 2)[0] == key {
+				env[i] = kv
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// 生成容器的 hostname、hosts 和 resolv.conf 文件，并在 init 进程的配置中加上它们的绑定挂载
+func initConfigWithEtcFiles(rootUrl string, info *model.ContainerInfo) (*model.InitConfig, error) {
+	mounts, err := container.SetUpEtcFiles(rootUrl, info)
+	if err != nil {
+		return nil, err
+	}
+	config := initConfigOf(info)
+	config.Mounts = mounts
+	return config, nil
+}
+
+// 确定新容器的容器名：没传容器名时将容器ID作为容器名，否则检查容器名是否重名
+func newContainerName(containerId, containerName string) (string, error) {
+	if containerName == "" {
+		return containerId, nil
+	}
+
+	exists, err := util.ContainerIsExistsByName(containerName)
+	if err != nil {
+		return "", fmt.Errorf("unknown error: %v", err)
+	}
+	if exists {
+		return "", fmt.Errorf("duplicate container name")
+	}
+	return containerName, nil
+}
+
+// CreateContainer 创建容器但不启动：准备好工作空间、cgroup、容器信息和容器ID与容器名的映射，容器的状态为 created
+// 之后通过 xdocker start 启动容器，启动时才会创建容器进程并连接网络
+func CreateContainer(opts *ContainerOptions) error {
+	var needRelease = true
+	// 记录容器信息之前持有容器状态的共享锁，避免 system reconcile 将创建了一半的容器当作残留清理掉
+	unlock, err := util.LockContainers(false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	containerId := util.RandStringBytes(10)
+	containerName, err := newContainerName(containerId, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	rootUrl, err := util.GetContainerRootPath(containerId)
+	if err != nil {
+		return err
+	}
+	mntUrl := rootUrl + "mnt/"
+
+	// 创建工作空间：包括创建只读层、读写层，联合挂载到mnt目录，进行数据卷的挂载
+	err = container.NewWorkSpace(rootUrl, opts.Image, containerName, mntUrl, opts.Volume)
+	if err != nil {
+		return fmt.Errorf("create: new workspace failed, error: %v", err)
+	}
+	defer func() {
+		if needRelease {
+			container.DeleteWorkSpace(rootUrl, mntUrl, opts.Volume)
+		}
+	}()
+
+	// 创建cgroup并设置资源限制，容器启动时再将容器进程加入cgroup
+	cm := cgroups.NewCgroupManager(fmt.Sprintf(model.DefaultCgroupPath, containerId))
+	if err = cm.Set(opts.Resource); err != nil {
+		return fmt.Errorf("cgroup set resource-limit failed, error: %v", err)
+	}
+	defer func() {
+		if needRelease {
+			if err := cm.Destroy(); err != nil {
+				fmt.Println(fmt.Errorf("remove cgroup directory failed, error: %v", err))
+			}
+		}
+	}()
+
+	info := opts.containerInfo(containerId, containerName)
+	info.Status = model.CREATED
+	if err = container.RecordContainerInfo(info); err != nil {
+		return fmt.Errorf("create: record container info failed, error: %v", err)
+	}
+	defer func() {
+		if needRelease {
+			if err := container.RemoveInfoPath(containerName); err != nil {
+				fmt.Println(fmt.Errorf("remove container info path failed, error: %v", err))
+			}
+		}
+	}()
+
+	if err = util.AddContainerMapping(containerId, containerName); err != nil {
+		return fmt.Errorf("create: add containerId - containerName mapping failed, error: %v", err)
+	}
+
+	needRelease = false
+	fmt.Println(containerId)
+	return nil
+}
+
+// 生成运行中的容器的容器信息
+func runningContainerInfo(opts *ContainerOptions, containerId, containerName string, pid int, ipAddress string) *model.ContainerInfo {
+	info := opts.containerInfo(containerId, containerName)
+	info.Pid = strconv.Itoa(pid)
+	info.PidStartTime, _ = util.ProcessStartTime(pid)
+	info.IpAddress = ipAddress
+	info.Status = model.RUNNING
+	info.StartedAt = time.Now().Format("2006-01-02 15:04:05")
+	if info.Healthcheck != nil {
+		info.Health = &model.HealthState{Status: model.HealthStarting}
+	}
+	return info
+}
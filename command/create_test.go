@@ -0,0 +1,47 @@
+package command
+
+import (
+	"github.com/iverson3/xdocker/model"
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestInitConfigOf(t *testing.T) {
+	opts := &ContainerOptions{
+		Cmd:        []string{"sh", "-c", "echo hello world"},
+		Env:        []string{"FOO=a b"},
+		Init:       true,
+		WorkingDir: "/app",
+		User:       "1000:1000",
+		Hostname:   "web",
+		ShmSize:    128 << 20,
+	}
+	config := initConfigOf(opts.containerInfo("id", "name"))
+	assert.DeepEqual(t, opts.Cmd, config.Args)
+	assert.DeepEqual(t, []string{"PATH=" + defaultPathEnv, "HOSTNAME=web", "FOO=a b"}, config.Env)
+	assert.Equal(t, "/app", config.Cwd)
+	assert.Equal(t, "1000:1000", config.User)
+	assert.Equal(t, "web", config.Hostname)
+	assert.Equal(t, true, config.Init)
+	assert.Equal(t, int64(128<<20), config.ShmSize)
+
+	// 没有指定主机名时使用容器ID
+	opts.Hostname = ""
+	assert.Equal(t, "id", opts.containerInfo("id", "name").Hostname)
+
+	// 旧版本创建的容器只记录了命令字符串
+	config = initConfigOf(&model.ContainerInfo{Command: "top -b"})
+	assert.DeepEqual(t, []string{"top", "-b"}, config.Args)
+}
+
+func TestContainerEnv(t *testing.T) {
+	info := &model.ContainerInfo{
+		Hostname: "web",
+		Tty:      true,
+		Env:      []string{"FOO=bar", "PATH=/app/bin", "TERM=vt100"},
+	}
+	assert.DeepEqual(t, []string{"PATH=/app/bin", "HOSTNAME=web", "TERM=vt100", "FOO=bar"}, containerEnv(info))
+
+	// 不继承 xdocker 自身的环境变量
+	assert.DeepEqual(t, []string{"PATH=" + defaultPathEnv}, containerEnv(&model.ContainerInfo{}))
+}
@@ -0,0 +1,83 @@
+package command
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/iverson3/xdocker/model"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 持续输出事件时检查新事件的时间间隔
+const eventsInterval = time.Second
+
+// ListEvents 输出事件日志中的容器事件
+// container 不为空时只输出该容器(容器ID或容器名)的事件；follow 为 true 时持续输出新产生的事件
+func ListEvents(container string, follow bool) error {
+	file, err := os.Open(model.DefaultEventLogPath)
+	if os.IsNotExist(err) && !follow {
+		// 还没有产生过任何事件
+		return nil
+	}
+	// 持续输出时等待事件日志文件的创建
+	for os.IsNotExist(err) {
+		time.Sleep(eventsInterval)
+		file, err = os.Open(model.DefaultEventLogPath)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return readEvents(bufio.NewReader(file), follow, eventsInterval, func(event *model.Event) bool {
+		if container == "" || event.ID == container || event.Name == container {
+			fmt.Println(formatEvent(event))
+		}
+		return true
+	})
+}
+
+// readEvents 逐行读取事件日志并交给 handle 处理，handle 返回 false 时停止读取
+// follow 为 true 时读到文件末尾之后每隔 interval 检查一次新产生的事件，否则读到文件末尾就返回
+func readEvents(reader *bufio.Reader, follow bool, interval time.Duration, handle func(event *model.Event) bool) error {
+	var partial string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err == io.EOF {
+			// 文件末尾可能是正在写入的半行，留到下次读取时拼接
+			partial += line
+			if !follow {
+				return nil
+			}
+			time.Sleep(interval)
+			continue
+		}
+
+		line = partial + line
+		partial = ""
+		event := new(model.Event)
+		if err = json.Unmarshal([]byte(line), event); err != nil {
+			continue
+		}
+		if !handle(event) {
+			return nil
+		}
+	}
+}
+
+// 格式化输出事件，比如 "2006-01-02 15:04:05 container die abcdef (exitCode=137, name=xxx, oomKilled=true)"
+func formatEvent(event *model.Event) string {
+	attributes := []string{"name=" + event.Name}
+	for key, value := range event.Attributes {
+		attributes = append(attributes, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(attributes)
+	return fmt.Sprintf("%s container %s %s (%s)", event.Time, event.Action, event.ID, strings.Join(attributes, ", "))
+}
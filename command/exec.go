@@ -5,6 +5,8 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"github.com/iverson3/xdocker/cgroups"
+	"github.com/iverson3/xdocker/model"
 	"github.com/iverson3/xdocker/util"
 )
 
@@ -35,34 +37,64 @@ func ExecContainer(container string, containerCmdArr []string) error {
 	if pid == "" {
 		return fmt.Errorf("container is not running")
 	}
+	info, err := util.GetContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+	// 暂停的容器已经被冻结，exec的进程加入cgroup之后也会被冻结
+	if info.Status == model.PAUSED {
+		return fmt.Errorf("container is paused, unpause the container before exec")
+	}
 	containerCmdStr := strings.Join(containerCmdArr, " ")
 
-	// 再次执行当前程序
-	cmd := exec.Command("/proc/self/exe", "exec")
+	cmd := newExecCommand(pid, containerEnv(info), containerCmdStr)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	// 设置环境变量 (当前程序再次被执行的时候由于环境变量设置好了，cgo代码会正常被执行，从而实现进入指定容器进程的NameSpace中)
-	err = os.Setenv(EnvExecPid, pid)
-	if err != nil {
+	if err = startExecProcess(cmd, info.ID); err != nil {
 		return err
 	}
-	err = os.Setenv(EnvExecCmd, containerCmdStr)
-	if err != nil {
+	if err = cmd.Wait(); err != nil {
 		return err
 	}
+	return nil
+}
 
-	// 将环境变量传入即将运行的子进程中
-	envs, err := util.GetEnvsByPid(pid)
+// 创建在容器中执行命令的进程，env 为根据容器信息生成的容器的环境变量
+// 不能读取容器进程的 /proc/<pid>/environ：使用 --init 时容器进程是 xdocker 的 init 进程，它的 environ 是启动它的进程的环境变量
+func newExecCommand(pid string, env []string, containerCmd string) *exec.Cmd {
+	// 再次执行当前程序
+	cmd := exec.Command("/proc/self/exe", "exec")
+
+	// 设置环境变量 (当前程序再次被执行的时候由于环境变量设置好了，cgo代码会正常被执行，从而实现进入指定容器进程的NameSpace中)
+	// 只设置在子进程上，不修改当前进程的环境变量 (shim 中执行健康检查时，当前进程之后还会启动容器进程)
+	cmd.Env = append(append([]string{}, env...), EnvExecPid+"="+pid, EnvExecCmd+"="+containerCmd)
+	return cmd
+}
+
+// 启动exec进程，并在它执行命令之前将它加入容器的cgroup
+func startExecProcess(cmd *exec.Cmd, containerId string) error {
+	// 通过管道通知子进程已经加入容器的cgroup，子进程在此之前不会执行命令
+	readPipe, writePipe, err := os.Pipe()
 	if err != nil {
 		return err
 	}
-	// 将上面新设置的环境变量和容器进程已有的环境变量合到一起
-	cmd.Env = append(os.Environ(), envs...)
+	defer writePipe.Close()
+	cmd.ExtraFiles = []*os.File{readPipe}
 
-	if err = cmd.Run(); err != nil {
+	err = cmd.Start()
+	readPipe.Close()
+	if err != nil {
 		return err
 	}
+
+	// 将exec的进程加入容器的cgroup，使其受到容器资源限制的约束
+	cm := cgroups.NewCgroupManager(fmt.Sprintf(model.DefaultCgroupPath, containerId))
+	if err = cm.AddProcess(cmd.Process.Pid); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("cgroup addProcess failed, error: %v", err)
+	}
 	return nil
-}
\ No newline at end of file
+}
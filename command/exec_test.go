@@ -0,0 +1,27 @@
+package command
+
+import (
+	"github.com/iverson3/xdocker/model"
+	"gotest.tools/assert"
+	"os"
+	"testing"
+)
+
+func TestNewExecCommand(t *testing.T) {
+	// 宿主机的环境变量不能进入容器
+	assert.NilError(t, os.Setenv("XDOCKER_TEST_HOST_ENV", "1"))
+	defer os.Unsetenv("XDOCKER_TEST_HOST_ENV")
+
+	info := &model.ContainerInfo{
+		Hostname: "web",
+		Env:      []string{"FOO=bar", "PATH=/bin"},
+	}
+	cmd := newExecCommand("42", containerEnv(info), "ls -l")
+	assert.DeepEqual(t, []string{
+		"PATH=/bin",
+		"HOSTNAME=web",
+		"FOO=bar",
+		EnvExecPid + "=42",
+		EnvExecCmd + "=ls -l",
+	}, cmd.Env)
+}
@@ -5,18 +5,19 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"github.com/iverson3/xdocker/container"
 	"github.com/iverson3/xdocker/model"
 	"github.com/iverson3/xdocker/util"
 )
 
 // ExportContainer 将容器打包为镜像压缩包文件并导出到指定的目录
-func ExportContainer(container, exportPath string) error {
-	exists, containerName, err := util.ContainerIsExists(container)
+func ExportContainer(containerFlag, exportPath string) error {
+	exists, containerName, err := util.ContainerIsExists(containerFlag)
 	if err != nil {
 		return err
 	}
 	if !exists {
-		return fmt.Errorf("container not exists: %s", container)
+		return fmt.Errorf("container not exists: %s", containerFlag)
 	}
 
 	containerInfo, err := util.GetContainerInfoByName(containerName)
@@ -51,7 +52,12 @@ func ExportContainer(container, exportPath string) error {
 
 	mntUrl := rootUrl + "mnt/"
 	imageTarUrl := filepath.Join(exportPath, fmt.Sprintf("%s.tar", containerName))
-	_, err = exec.Command("tar", "-czf", imageTarUrl, "-C", mntUrl, ".").CombinedOutput()
+	// 排除为绑定挂载 etc 文件而创建的空占位文件
+	tarArgs := []string{"-czf", imageTarUrl, "-C", mntUrl, "--anchored"}
+	for _, placeholder := range container.EtcFilePlaceholders(rootUrl, containerInfo.Image) {
+		tarArgs = append(tarArgs, "--exclude="+placeholder)
+	}
+	_, err = exec.Command("tar", append(tarArgs, ".")...).CombinedOutput()
 	if err != nil {
 		fmt.Println(fmt.Errorf("CommitContainer: tar container failed, error: %v", err))
 		return err
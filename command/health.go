@@ -0,0 +1,228 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/iverson3/xdocker/model"
+	"github.com/iverson3/xdocker/util"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// 健康检查配置的默认值 (与 docker 一致)
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 30 * time.Second
+	defaultHealthRetries  = 3
+
+	// 容器信息中保留的最近的检查结果数量
+	healthLogSize = 5
+	// 每次检查保留的输出的最大长度
+	healthOutputLimit = 4096
+)
+
+// healthChecker 按照容器的健康检查配置，定期通过 exec 的方式在容器中执行检查命令，并将健康状态记录到容器信息中
+// 每个容器进程对应一个 healthChecker，容器进程退出之后需要调用 Stop
+type healthChecker struct {
+	name   string
+	id     string
+	pid    int
+	env    []string
+	config model.HealthConfig
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// startHealthCheck 开始对容器进行健康检查，容器没有配置健康检查时返回 nil
+func startHealthCheck(info *model.ContainerInfo, pid int) *healthChecker {
+	if info.Healthcheck == nil || info.Healthcheck.Cmd == "" {
+		return nil
+	}
+
+	h := &healthChecker{
+		name:   info.Name,
+		id:     info.ID,
+		pid:    pid,
+		env:    containerEnv(info),
+		config: healthConfigWithDefaults(info.Healthcheck),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+// Stop 停止健康检查，并等待正在进行的检查结束
+func (h *healthChecker) Stop() {
+	if h == nil {
+		return
+	}
+	close(h.stop)
+	<-h.done
+}
+
+func (h *healthChecker) run() {
+	defer close(h.done)
+
+	startedAt := time.Now()
+	ticker := time.NewTicker(h.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+
+		// 暂停的容器中检查命令也会被冻结，直到超时，不能计入失败次数
+		if h.paused() {
+			continue
+		}
+		probe := h.probe()
+		select {
+		case <-h.stop:
+			// 容器已经退出，这次检查的失败是容器退出导致的，不需要记录
+			return
+		default:
+		}
+		if err := h.record(probe, time.Since(startedAt) < h.config.StartPeriod); err != nil {
+			fmt.Println(fmt.Errorf("record health check result failed, error: %v", err))
+		}
+	}
+}
+
+// 容器是否处于暂停状态
+func (h *healthChecker) paused() bool {
+	info, err := util.GetContainerInfoByName(h.name)
+	return err == nil && info.Status == model.PAUSED
+}
+
+// 在容器中执行一次检查命令，超时之后杀死检查命令的所有进程
+func (h *healthChecker) probe() (probe model.HealthProbe) {
+	probe = model.HealthProbe{
+		Start:    time.Now().Format("2006-01-02 15:04:05"),
+		ExitCode: -1,
+	}
+	defer func() {
+		probe.End = time.Now().Format("2006-01-02 15:04:05")
+	}()
+
+	cmd := newExecCommand(strconv.Itoa(h.pid), h.env, h.config.Cmd)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// 检查命令及其子进程在同一个进程组中，超时的时候可以一起杀死
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := startExecProcess(cmd, h.id); err != nil {
+		probe.Output = err.Error()
+		return probe
+	}
+
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- cmd.Wait()
+	}()
+	timer := time.NewTimer(h.config.Timeout)
+	defer timer.Stop()
+	select {
+	case <-waitCh:
+		probe.ExitCode = exitCodeOf(cmd.ProcessState)
+		probe.Output = truncateOutput(output.String())
+	case <-timer.C:
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-waitCh
+		probe.Output = fmt.Sprintf("health check exceeded timeout (%v)", h.config.Timeout)
+	}
+	return probe
+}
+
+// 将检查结果记录到容器信息中，健康状态发生变化时记录 health_status 事件
+func (h *healthChecker) record(probe model.HealthProbe, inStartPeriod bool) error {
+	info, err := util.GetContainerInfoByName(h.name)
+	if err != nil {
+		return err
+	}
+	// 容器进程已经退出或者已经被重新启动了
+	if info.Pid != strconv.Itoa(h.pid) {
+		return nil
+	}
+
+	health := info.Health
+	if health == nil {
+		health = &model.HealthState{Status: model.HealthStarting}
+	}
+	oldStatus := health.Status
+	updateHealth(health, probe, h.config.Retries, inStartPeriod)
+
+	// 检查期间容器信息可能已经被 pause、stop 等命令修改，保存之前重新读取，只更新健康状态
+	info, err = util.GetContainerInfoByName(h.name)
+	if err != nil {
+		return err
+	}
+	if info.Pid != strconv.Itoa(h.pid) {
+		return nil
+	}
+	// 检查期间容器被暂停了，检查命令被冻结导致的失败不记录
+	if info.Status == model.PAUSED {
+		return nil
+	}
+	info.Health = health
+	if err = util.SaveContainerInfo(info); err != nil {
+		return err
+	}
+
+	if health.Status != oldStatus {
+		err = util.RecordEvent(model.EventHealthStatus, info.ID, info.Name, map[string]string{
+			"status": health.Status,
+		})
+		if err != nil {
+			fmt.Println(fmt.Errorf("record health_status event failed, error: %v", err))
+		}
+	}
+	return nil
+}
+
+// updateHealth 根据一次检查的结果更新健康状态
+// 检查成功则为 healthy；连续失败 retries 次之后为 unhealthy；启动初始化期间的失败不计入失败次数
+func updateHealth(state *model.HealthState, probe model.HealthProbe, retries int, inStartPeriod bool) {
+	state.Log = append(state.Log, probe)
+	if len(state.Log) > healthLogSize {
+		state.Log = state.Log[len(state.Log)-healthLogSize:]
+	}
+
+	if probe.ExitCode == 0 {
+		state.Status = model.HealthHealthy
+		state.FailingStreak = 0
+		return
+	}
+	if inStartPeriod && state.Status == model.HealthStarting {
+		return
+	}
+	state.FailingStreak++
+	if state.FailingStreak >= retries {
+		state.Status = model.HealthUnhealthy
+	}
+}
+
+// 没有设置的健康检查配置使用默认值
+func healthConfigWithDefaults(config *model.HealthConfig) model.HealthConfig {
+	c := *config
+	if c.Interval <= 0 {
+		c.Interval = defaultHealthInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultHealthTimeout
+	}
+	if c.Retries <= 0 {
+		c.Retries = defaultHealthRetries
+	}
+	return c
+}
+
+func truncateOutput(output string) string {
+	if len(output) > healthOutputLimit {
+		return output[:healthOutputLimit]
+	}
+	return output
+}
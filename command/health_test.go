@@ -0,0 +1,48 @@
+package command
+
+import (
+	"github.com/iverson3/xdocker/model"
+	"gotest.tools/assert"
+	"testing"
+	"time"
+)
+
+func TestUpdateHealth(t *testing.T) {
+	state := &model.HealthState{Status: model.HealthStarting}
+	failed := model.HealthProbe{ExitCode: 1}
+	passed := model.HealthProbe{ExitCode: 0}
+
+	// 启动初始化期间的失败不计入失败次数
+	updateHealth(state, failed, 2, true)
+	assert.Equal(t, model.HealthStarting, state.Status)
+	assert.Equal(t, 0, state.FailingStreak)
+
+	updateHealth(state, failed, 2, false)
+	assert.Equal(t, model.HealthStarting, state.Status)
+	assert.Equal(t, 1, state.FailingStreak)
+
+	updateHealth(state, failed, 2, false)
+	assert.Equal(t, model.HealthUnhealthy, state.Status)
+	assert.Equal(t, 2, state.FailingStreak)
+
+	updateHealth(state, passed, 2, false)
+	assert.Equal(t, model.HealthHealthy, state.Status)
+	assert.Equal(t, 0, state.FailingStreak)
+
+	// 已经 healthy 之后，启动初始化期间的失败也会计入失败次数
+	updateHealth(state, failed, 2, true)
+	assert.Equal(t, 1, state.FailingStreak)
+
+	// 只保留最近的几次检查结果
+	assert.Equal(t, healthLogSize, len(state.Log))
+	updateHealth(state, passed, 2, false)
+	assert.Equal(t, healthLogSize, len(state.Log))
+	assert.Equal(t, 0, state.Log[healthLogSize-1].ExitCode)
+}
+
+func TestHealthConfigWithDefaults(t *testing.T) {
+	config := healthConfigWithDefaults(&model.HealthConfig{Cmd: "true", Interval: time.Second})
+	assert.Equal(t, time.Second, config.Interval)
+	assert.Equal(t, defaultHealthTimeout, config.Timeout)
+	assert.Equal(t, defaultHealthRetries, config.Retries)
+}
@@ -2,7 +2,8 @@ package command
 
 import (
 	"fmt"
-	"io/ioutil"
+	"github.com/iverson3/xdocker/container"
+	"github.com/iverson3/xdocker/model"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -48,15 +49,25 @@ func InitChildProcess() (err error) {
 	//		_ = cm.Destroy()
 	//	}
 	//}()
+	config, err := container.ReadInitConfig()
+	if err != nil {
+		return fmt.Errorf("init process failed, error: %v", err)
+	}
+
 	// 挂载相关设置
-	err = setUpMount()
+	err = setUpMount(config.Mounts, config.ShmSize)
 	if err != nil {
 		return err
 	}
+	containerCmd := config.Args
 
-	containerCmd := readCommand()
-	if containerCmd == nil || len(containerCmd) == 0 {
-		return fmt.Errorf("init process failed, containerCmd is nil")
+	// 用户命令的环境变量以 xdocker 发送过来的为准
+	os.Clearenv()
+	for _, env := range config.Env {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) == 2 {
+			_ = os.Setenv(kv[0], kv[1])
+		}
 	}
 
 	//value, _ := syscall.Getenv("PATH")
@@ -70,6 +81,34 @@ func InitChildProcess() (err error) {
 		return err
 	}
 
+	if config.Hostname != "" {
+		if err = syscall.Sethostname([]byte(config.Hostname)); err != nil {
+			return fmt.Errorf("set hostname failed, error: %v", err)
+		}
+	}
+	if err = setUpWorkDir(config.Cwd); err != nil {
+		return err
+	}
+	var user *execUser
+	if config.User != "" {
+		if user, err = resolveUserFromFiles(config.User); err != nil {
+			return err
+		}
+	}
+	// 终端在容器自己的 devpts 中分配，容器中的 tty、ttyname 等才能找到它；需要在切换用户之前完成
+	if config.Tty {
+		uid := 0
+		if user != nil {
+			uid = user.Uid
+		}
+		if err = container.SetUpConsole(uid); err != nil {
+			return err
+		}
+	}
+	if err = setUpUser(user); err != nil {
+		return err
+	}
+
 	// 这里我们添加了 lookPath，这个是用于解决每次我们都要输入 /bin/ls 的麻烦的，
 	// 这个函数会帮我们找到参数命令的绝对路径。也就是说，你只需要输入 ls 即可，lookPath 会自动找到 /bin/ls 的。
 	// 然后我们再把这个 path 作为 argv0 传给 syscall.Exec。
@@ -109,6 +148,11 @@ func InitChildProcess() (err error) {
 	//	fmt.Println(fmt.Errorf("ERROR: initProcess source /etc/bashrc failed, error: %v", err))
 	//}
 
+	// 使用 --init 运行的容器由当前进程作为1号进程，用户命令作为子进程运行
+	if config.Init {
+		return runMiniInit(cmdPath, containerCmd, os.Environ())
+	}
+
 	// 运行用户指定的命令或程序
 	err = syscall.Exec(cmdPath, containerCmd, os.Environ())
 	if err != nil {
@@ -119,8 +163,8 @@ func InitChildProcess() (err error) {
 	return nil
 }
 
-// 初始化挂载点
-func setUpMount() error {
+// 初始化挂载点，mounts 为切换根目录之前需要绑定挂载到容器中的宿主机文件
+func setUpMount(mounts []model.MountConfig, shmSize int64) error {
 	// 首先设置根目录为私有模式，防止影响pivot_root
 	// private方式挂载，不影响宿主机的挂载
 	// 意思其实就是mount的传播问题：必须让父进程、子进程都不是分享模式。
@@ -136,6 +180,12 @@ func setUpMount() error {
 		return fmt.Errorf("setUpMount: get current location failed, error: %v", err)
 	}
 
+	for _, m := range mounts {
+		if err = bindMount(pwd, m); err != nil {
+			return err
+		}
+	}
+
 	err = privotRoot(pwd)
 	if err != nil {
 		return err
@@ -148,11 +198,115 @@ func setUpMount() error {
 		return fmt.Errorf("setUpMount: mount /proc failed, error: %v\n", err)
 	}
 
-	// 挂载tmpfs文件系统
-	//err = syscall.Mount("tmpfs", "/dev", "tempfs", syscall.MS_NOSUID|syscall.MS_STRICTATIME, "mode=755")
-	//if err != nil {
-	//	return fmt.Errorf("setUpMount: mount tmpfs failed, error: %v", err)
-	//}
+	// 挂载只读的sysfs，容器中的程序可以读取系统信息但不能修改内核参数
+	if err = os.MkdirAll("/sys", 0555); err != nil {
+		return fmt.Errorf("setUpMount: mkdir /sys failed, error: %v", err)
+	}
+	err = syscall.Mount("sysfs", "/sys", "sysfs", uintptr(defaultMountFlags|syscall.MS_RDONLY), "")
+	if err != nil {
+		return fmt.Errorf("setUpMount: mount /sys failed, error: %v", err)
+	}
+
+	return setUpDev(shmSize)
+}
+
+// 容器 /dev 中的设备，与 OCI 规范中默认的设备一致
+var defaultDevices = []struct {
+	Path  string
+	Major uint32
+	Minor uint32
+}{
+	{"/dev/null", 1, 3},
+	{"/dev/zero", 1, 5},
+	{"/dev/full", 1, 7},
+	{"/dev/random", 1, 8},
+	{"/dev/urandom", 1, 9},
+	{"/dev/tty", 5, 0},
+}
+
+// 容器 /dev 中的符号链接
+var defaultDevSymlinks = [][2]string{
+	{"/proc/self/fd", "/dev/fd"},
+	{"/proc/self/fd/0", "/dev/stdin"},
+	{"/proc/self/fd/1", "/dev/stdout"},
+	{"/proc/self/fd/2", "/dev/stderr"},
+	{"pts/ptmx", "/dev/ptmx"},
+}
+
+// 在 /dev 挂载 tmpfs 并创建最小的设备集合，不使用镜像中的 /dev，也不暴露宿主机的设备
+// 再挂载容器独立的 devpts (/dev/pts) 和 /dev/shm
+func setUpDev(shmSize int64) error {
+	if shmSize <= 0 {
+		shmSize = model.DefaultShmSize
+	}
+	if err := os.MkdirAll("/dev", 0755); err != nil {
+		return fmt.Errorf("setUpDev: mkdir /dev failed, error: %v", err)
+	}
+	err := syscall.Mount("tmpfs", "/dev", "tmpfs", syscall.MS_NOSUID|syscall.MS_STRICTATIME, "mode=755,size=65536k")
+	if err != nil {
+		return fmt.Errorf("setUpDev: mount /dev failed, error: %v", err)
+	}
+
+	// 创建设备文件时不受 umask 的影响
+	oldMask := syscall.Umask(0)
+	defer syscall.Umask(oldMask)
+	for _, dev := range defaultDevices {
+		// 主次设备号都很小，可以直接使用旧的 major<<8|minor 编码
+		err = syscall.Mknod(dev.Path, syscall.S_IFCHR|0666, int(dev.Major<<8|dev.Minor))
+		if err != nil {
+			return fmt.Errorf("setUpDev: mknod %s failed, error: %v", dev.Path, err)
+		}
+	}
+	for _, link := range defaultDevSymlinks {
+		if err = os.Symlink(link[0], link[1]); err != nil {
+			return fmt.Errorf("setUpDev: symlink %s failed, error: %v", link[1], err)
+		}
+	}
+
+	// newinstance 使容器拥有独立的 pty 编号空间，看不到宿主机和其他容器的终端
+	if err = os.Mkdir("/dev/pts", 0755); err != nil {
+		return fmt.Errorf("setUpDev: mkdir /dev/pts failed, error: %v", err)
+	}
+	err = syscall.Mount("devpts", "/dev/pts", "devpts", syscall.MS_NOSUID|syscall.MS_NOEXEC, "newinstance,ptmxmode=0666,mode=0620,gid=5")
+	if err != nil {
+		return fmt.Errorf("setUpDev: mount /dev/pts failed, error: %v", err)
+	}
+
+	if err = os.Mkdir("/dev/shm", 01777); err != nil {
+		return fmt.Errorf("setUpDev: mkdir /dev/shm failed, error: %v", err)
+	}
+	err = syscall.Mount("shm", "/dev/shm", "tmpfs", syscall.MS_NOSUID|syscall.MS_NOEXEC|syscall.MS_NODEV, fmt.Sprintf("mode=1777,size=%d", shmSize))
+	if err != nil {
+		return fmt.Errorf("setUpDev: mount /dev/shm failed, error: %v", err)
+	}
+	return nil
+}
+
+// 将宿主机上的文件绑定挂载到容器的 rootfs 中，挂载只存在于容器的 mount namespace 中，容器退出后自动消失
+func bindMount(rootfs string, m model.MountConfig) error {
+	// 镜像中的目标文件可能是符号链接 (比如指向 /run/systemd/resolve/stub-resolv.conf)
+	// 此时还没有切换根目录，所以在 rootfs 中解析符号链接，挂载到链接指向的文件上，不修改镜像中的符号链接
+	target, err := container.ResolveInRoot(rootfs, m.Destination)
+	if err != nil {
+		return fmt.Errorf("bindMount: resolve %s failed, error: %v", m.Destination, err)
+	}
+	// 挂载点必须存在，镜像中没有时才在读写层中创建占位文件 (提交容器时会被排除，见 container.EtcFilePlaceholders)
+	if _, err = os.Stat(target); os.IsNotExist(err) {
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("bindMount: mkdir for %s failed, error: %v", m.Destination, err)
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_RDONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("bindMount: create %s failed, error: %v", m.Destination, err)
+		}
+		_ = f.Close()
+	} else if err != nil {
+		return fmt.Errorf("bindMount: stat %s failed, error: %v", m.Destination, err)
+	}
+
+	if err = syscall.Mount(m.Source, target, "bind", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bindMount: mount %s to %s failed, error: %v", m.Source, m.Destination, err)
+	}
 	return nil
 }
 
@@ -213,16 +367,35 @@ func privotRoot(root string) error {
 	return os.Remove(pivotDir)
 }
 
-func readCommand() []string {
-	// 对于标准输入、输出、错误,在创建子进程的时候都是默认带着的/继承的, 所以前三个文件描述符就是这三个
-	// 第四个(下标3)则是我们的传过来的用来传递命令参数的管道
-	pipe := os.NewFile(uintptr(3), "pipe")
-	// 实际运行中，当进程运行到 readCommand() 的时候会堵塞，直到 write 端传数据进来。
-	// 不用担心我们在容器运行后再传输参数。因为在读取完参数之前，init 函数也不会运行到 syscall.Exec 这一步
-	msg, err := ioutil.ReadAll(pipe)
-	if err != nil {
-		fmt.Println(fmt.Errorf("ERROR: read pipe failed, error: %v\n", err))
+// 切换到用户命令的工作目录，目录不存在时创建
+func setUpWorkDir(cwd string) error {
+	if cwd == "" {
 		return nil
 	}
-	return strings.Split(string(msg), " ")
-}
\ No newline at end of file
+	if err := os.MkdirAll(cwd, 0755); err != nil {
+		return fmt.Errorf("create working directory %s failed, error: %v", cwd, err)
+	}
+	if err := syscall.Chdir(cwd); err != nil {
+		return fmt.Errorf("chdir to working directory %s failed, error: %v", cwd, err)
+	}
+	return nil
+}
+
+// 切换到运行用户命令的用户 (由 resolveUserFromFiles 在容器自己的 /etc/passwd 和 /etc/group 中解析)，为 nil 时保持 root
+func setUpUser(user *execUser) error {
+	if user == nil {
+		return nil
+	}
+
+	// 先设置组再设置用户，切换到非 root 用户之后就没有权限修改组了
+	if err := syscall.Setgroups(user.Groups); err != nil {
+		return fmt.Errorf("setgroups failed, error: %v", err)
+	}
+	if err := syscall.Setgid(user.Gid); err != nil {
+		return fmt.Errorf("setgid failed, error: %v", err)
+	}
+	if err := syscall.Setuid(user.Uid); err != nil {
+		return fmt.Errorf("setuid failed, error: %v", err)
+	}
+	return nil
+}
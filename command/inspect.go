@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"github.com/iverson3/xdocker/cgroups"
+	"github.com/iverson3/xdocker/model"
 	"github.com/iverson3/xdocker/util"
 	"text/tabwriter"
 )
@@ -31,12 +33,23 @@ func InspectContainer(container string) error {
 	for k := 0; k < t.NumField(); k++ {
 		_, _ = fmt.Fprintf(
 			w,
-			"%s\t%s\t\n",
+			"%s\t%v\t\n",
 			t.Field(k).Tag.Get("json"),
 			values.Field(k).Interface(),
 		)
 	}
 
+	// 运行中的容器额外输出当前的进程数
+	if info.Status == model.RUNNING || info.Status == model.PAUSED {
+		cm := cgroups.NewCgroupManager(fmt.Sprintf(model.DefaultCgroupPath, info.ID))
+		pidsCurrent, err := cm.GetPidsCurrent()
+		if err != nil {
+			fmt.Println(fmt.Errorf("get current pids failed, error: %v", err))
+		} else {
+			_, _ = fmt.Fprintf(w, "%s\t%d\t\n", "pids_current", pidsCurrent)
+		}
+	}
+
 	err = w.Flush()
 	if err != nil {
 		return err
@@ -0,0 +1,61 @@
+package command
+
+import (
+	"fmt"
+	"github.com/iverson3/xdocker/cgroups"
+	"github.com/iverson3/xdocker/model"
+	"github.com/iverson3/xdocker/util"
+	"strings"
+	"syscall"
+)
+
+// KillContainers 给运行中的容器发送信号，all 为 true 时发送给容器 cgroup 中的所有进程，否则只发送给容器的 init 进程
+// 容器的状态由 shim 在容器进程退出之后更新，这里只负责发送信号
+func KillContainers(containers []string, signal string, all bool) error {
+	sig, err := ParseSignal(signal)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, containerFlag := range containers {
+		if err = killContainerWithSignal(containerFlag, sig, all); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", containerFlag, err))
+			continue
+		}
+		fmt.Println(containerFlag)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("kill container failed, error: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func killContainerWithSignal(containerFlag string, sig syscall.Signal, all bool) error {
+	exists, containerName, err := util.ContainerIsExists(containerFlag)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("container not exists")
+	}
+
+	info, err := util.GetContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+	// 暂停的容器的进程被冻结了，无法处理信号
+	if info.Status == model.PAUSED {
+		return fmt.Errorf("container is paused, unpause it first")
+	}
+	if info.Status != model.RUNNING {
+		return fmt.Errorf("container not running")
+	}
+
+	if all {
+		cm := cgroups.NewCgroupManager(fmt.Sprintf(model.DefaultCgroupPath, info.ID))
+		return cm.SignalAll(sig)
+	}
+	// 通过容器的 shim 进程给容器的 init 进程发送信号
+	return signalContainer(info, sig)
+}
@@ -0,0 +1,74 @@
+package command
+
+import (
+	"fmt"
+	"github.com/iverson3/xdocker/util"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runMiniInit 容器使用 --init 运行时，xdocker 的 init 进程不再 exec 用户命令，而是作为容器的1号进程留下来：
+// 以子进程的方式运行用户命令，将收到的所有信号转发给它，回收容器中所有的僵尸进程 (孤儿进程都会被托管给1号进程)，
+// 用户命令退出之后以它的退出码退出 (被信号杀死时为 128 + 信号值)
+// 大多数程序并不会像1号进程应该做的那样回收孤儿进程、处理 SIGTERM，所以需要这样一个小型的 init
+func runMiniInit(cmdPath string, args, env []string) error {
+	// 在启动子进程之前开始接收信号，避免子进程很快退出时漏掉 SIGCHLD
+	sigCh := make(chan os.Signal, 32)
+	signal.Notify(sigCh)
+
+	// 用户命令放到单独的进程组中，容器有终端时将其设置为终端的前台进程组 (与 tini 一致)
+	// 这样终端产生的信号 (Ctrl-C 的 SIGINT、终端大小变化的 SIGWINCH 等) 只会由内核发给用户命令，不会再被转发一次
+	sys := &syscall.SysProcAttr{Setpgid: true}
+	if util.IsTerminal(os.Stdin.Fd()) {
+		sys.Foreground = true
+		sys.Ctty = int(os.Stdin.Fd())
+	}
+	childPid, err := syscall.ForkExec(cmdPath, args, &syscall.ProcAttr{
+		Env:   env,
+		Files: []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd()},
+		Sys:   sys,
+	})
+	if err != nil {
+		return fmt.Errorf("start '%s' failed, error: %v", cmdPath, err)
+	}
+
+	for sig := range sigCh {
+		switch sig {
+		case syscall.SIGCHLD:
+			if exitCode, exited := reapChildren(childPid); exited {
+				os.Exit(exitCode)
+			}
+		case syscall.SIGURG:
+			// Go 运行时用于抢占调度的信号，不是发给容器的
+		default:
+			_ = syscall.Kill(childPid, sig.(syscall.Signal))
+		}
+	}
+	return nil
+}
+
+// 回收所有已经退出的子进程，用户命令退出时返回它的退出码
+func reapChildren(childPid int) (int, bool) {
+	exitCode, exited := 0, false
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err != nil || pid <= 0 {
+			return exitCode, exited
+		}
+		if pid != childPid {
+			continue
+		}
+		exited = true
+		exitCode = waitStatusExitCode(status)
+	}
+}
+
+// 根据子进程的退出状态计算退出码，被信号杀死时为 128 + 信号值
+func waitStatusExitCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
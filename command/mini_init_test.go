@@ -0,0 +1,77 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"gotest.tools/assert"
+	"io/ioutil"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWaitStatusExitCode(t *testing.T) {
+	// WaitStatus 的编码：正常退出时退出码在第8-15位，被信号杀死时低7位为信号值，0x80 表示产生了 core dump
+	cases := []struct {
+		status   syscall.WaitStatus
+		exitCode int
+	}{
+		{0, 0},
+		{3 << 8, 3},
+		{255 << 8, 255},
+		{syscall.WaitStatus(syscall.SIGTERM), 143},
+		{syscall.WaitStatus(syscall.SIGKILL), 137},
+		{syscall.WaitStatus(syscall.SIGSEGV) | 0x80, 139},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.exitCode, waitStatusExitCode(c.status), "status %#x", int(c.status))
+	}
+}
+
+func TestReapChildren(t *testing.T) {
+	cases := []struct {
+		script   string
+		exitCode int
+	}{
+		{"exit 0", 0},
+		{"exit 3", 3},
+		{"kill -TERM $$", 143},
+		{"kill -KILL $$", 137},
+	}
+	for _, c := range cases {
+		// 先启动一个不是用户命令的子进程并等它退出，回收用户命令的同时它也要被回收
+		other, err := syscall.ForkExec("/bin/sh", []string{"sh", "-c", "exit 1"}, &syscall.ProcAttr{})
+		assert.NilError(t, err)
+		deadline := time.Now().Add(5 * time.Second)
+		for !isZombie(other) {
+			assert.Assert(t, time.Now().Before(deadline), "child %d did not exit", other)
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		childPid, err := syscall.ForkExec("/bin/sh", []string{"sh", "-c", c.script}, &syscall.ProcAttr{})
+		assert.NilError(t, err)
+		for {
+			exitCode, exited := reapChildren(childPid)
+			if exited {
+				assert.Equal(t, c.exitCode, exitCode, c.script)
+				break
+			}
+			assert.Assert(t, time.Now().Before(deadline), "%s did not exit", c.script)
+			time.Sleep(10 * time.Millisecond)
+		}
+		_, err = syscall.Wait4(other, nil, syscall.WNOHANG, nil)
+		assert.Equal(t, syscall.ECHILD, err, c.script)
+	}
+}
+
+// 进程是否已经退出但还没有被回收
+func isZombie(pid int) bool {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// 进程名可能包含空格，状态在最后一个 ')' 之后
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
@@ -0,0 +1,127 @@
+package command
+
+import (
+	"fmt"
+	"github.com/iverson3/xdocker/cgroups"
+	"github.com/iverson3/xdocker/model"
+	"github.com/iverson3/xdocker/network"
+	"github.com/iverson3/xdocker/util"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// oomWatcher 在后台监听容器的OOM事件，每次OOM都会记录到事件日志中
+type oomWatcher struct {
+	info     *model.ContainerInfo
+	cm       *cgroups.CgroupManager
+	oomCount uint64
+	killed   int32
+}
+
+func newOOMWatcher(info *model.ContainerInfo, cm *cgroups.CgroupManager) *oomWatcher {
+	w := &oomWatcher{info: info, cm: cm}
+	w.oomCount, _ = cm.OOMKillCount()
+	oomCh, err := cm.NotifyOOM()
+	if err != nil {
+		// 无法监听OOM事件时依然可以通过容器退出后的OOM计数来判断
+		fmt.Println(fmt.Errorf("notify oom failed, error: %v", err))
+	}
+
+	go func() {
+		for range oomCh {
+			atomic.StoreInt32(&w.killed, 1)
+			recordOOMEvent(info)
+		}
+	}()
+	return w
+}
+
+// Killed 在容器退出之后获取容器运行期间是否发生过OOM
+func (w *oomWatcher) Killed() bool {
+	if atomic.LoadInt32(&w.killed) == 1 {
+		return true
+	}
+	// 容器进程被杀死时，OOM事件可能还没来得及通知过来，所以再比较一次OOM计数
+	if count, err := w.cm.OOMKillCount(); err == nil && count > w.oomCount {
+		atomic.StoreInt32(&w.killed, 1)
+		recordOOMEvent(w.info)
+		return true
+	}
+	return false
+}
+
+// Reset 容器重启之后重新开始统计
+func (w *oomWatcher) Reset() {
+	w.oomCount, _ = w.cm.OOMKillCount()
+	atomic.StoreInt32(&w.killed, 0)
+}
+
+// exitCodeOf 根据进程的退出状态计算退出码，被信号杀死时退出码为 128 + 信号值
+func exitCodeOf(state *os.ProcessState) int {
+	if state == nil {
+		return -1
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
+
+func recordOOMEvent(info *model.ContainerInfo) {
+	err := util.RecordEvent(model.EventOOM, info.ID, info.Name, nil)
+	if err != nil {
+		fmt.Println(fmt.Errorf("record oom event failed, error: %v", err))
+	}
+}
+
+func recordDieEvent(info *model.ContainerInfo, exitCode int, oomKilled bool) {
+	err := util.RecordEvent(model.EventDie, info.ID, info.Name, map[string]string{
+		"exitCode":  strconv.Itoa(exitCode),
+		"oomKilled": strconv.FormatBool(oomKilled),
+	})
+	if err != nil {
+		fmt.Println(fmt.Errorf("record die event failed, error: %v", err))
+	}
+}
+
+// recordContainerExit 记录容器的退出事件，并更新容器信息中的状态、退出码和退出时间
+// 如果容器信息中的Pid已经不是退出的进程 (比如容器已经被stop或者重新start)，则只记录事件
+func recordContainerExit(containerName string, pid int, exitCode int, oomKilled bool) error {
+	info, err := util.GetContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+
+	recordDieEvent(info, exitCode, oomKilled)
+	if info.Pid != strconv.Itoa(pid) || (info.Status != model.RUNNING && info.Status != model.PAUSED) {
+		return nil
+	}
+
+	// 和 stop 一样，容器退出之后需要释放IP地址
+	if info.NetworkName != "" && info.IpAddress != "" {
+		if err = network.Init(); err != nil {
+			fmt.Println(fmt.Errorf("network Init() failed, error: %v", err))
+		} else {
+			err = network.ReleaseIpAddress(info.NetworkName, info.IpAddress)
+			if err != nil {
+				fmt.Println(fmt.Errorf("network ReleaseIpAddress failed, error: %v", err))
+			}
+		}
+	}
+
+	// 被用户手动停止的容器记为 stop 状态，不会被自动重启
+	info.Status = model.EXIT
+	if info.ManuallyStopped {
+		info.Status = model.STOP
+	}
+	info.Pid = ""
+	info.PidStartTime = ""
+	info.IpAddress = ""
+	info.OOMKilled = oomKilled
+	info.ExitCode = exitCode
+	info.FinishedAt = time.Now().Format("2006-01-02 15:04:05")
+	return util.SaveContainerInfo(info)
+}
@@ -4,10 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"strconv"
+	"github.com/iverson3/xdocker/cgroups"
 	"github.com/iverson3/xdocker/model"
 	"github.com/iverson3/xdocker/util"
-	"syscall"
 )
 
 // PauseContainer 暂停一个运行中的容器
@@ -30,15 +29,13 @@ func PauseContainer(containerFlag string) error {
 		return fmt.Errorf("container not running")
 	}
 
-	pid, err := strconv.Atoi(info.Pid)
+	// 冻结容器cgroup中的所有进程 (包括容器的子进程和通过exec进入容器的进程)，并等待冻结完成
+	cm := cgroups.NewCgroupManager(fmt.Sprintf(model.DefaultCgroupPath, info.ID))
+	err = cm.Freeze()
 	if err != nil {
-		return err
-	}
-
-	// 使用"kill -STOP"命令将容器进程暂停
-	err = syscall.Kill(pid, syscall.SIGSTOP)
-	if err != nil {
-		return err
+		// 冻结失败时需要解冻，避免容器停留在部分冻结的状态
+		_ = cm.Thaw()
+		return fmt.Errorf("freeze container failed, error: %v", err)
 	}
 
 	// 更新容器的状态
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"github.com/iverson3/xdocker/cgroups"
+	"github.com/iverson3/xdocker/cgroups/subsystems"
 	"github.com/iverson3/xdocker/model"
 	"github.com/iverson3/xdocker/util"
 	"text/tabwriter"
@@ -40,7 +42,7 @@ func ListContainer() error {
 			item.Name,
 			item.Pid,
 			item.Image,
-			item.Status,
+			formatStatus(item),
 			item.Command,
 			item.CreateTime)
 	}
@@ -50,4 +52,34 @@ func ListContainer() error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// 格式化容器状态，已退出的容器附带退出码，发生过OOM的容器附带 OOMKilled 标记
+// 运行中和暂停的容器以cgroup实际的冻结状态为准，冻结过程还没完成时显示 freezing
+func formatStatus(info *model.ContainerInfo) string {
+	status := info.Status
+	if info.Status == model.RUNNING || info.Status == model.PAUSED {
+		cm := cgroups.NewCgroupManager(fmt.Sprintf(model.DefaultCgroupPath, info.ID))
+		if state, err := cm.FreezerState(); err == nil {
+			switch state {
+			case subsystems.Frozen:
+				status = model.PAUSED
+			case subsystems.Freezing:
+				status = "freezing"
+			case subsystems.Thawed:
+				status = model.RUNNING
+			}
+		}
+	}
+	// 配置了健康检查的运行中的容器显示健康状态
+	if info.Status == model.RUNNING && info.Health != nil {
+		status = fmt.Sprintf("%s (%s)", status, info.Health.Status)
+	}
+	if info.Status == model.EXIT && info.ExitCode >= 0 {
+		status = fmt.Sprintf("%s (%d)", status, info.ExitCode)
+	}
+	if info.OOMKilled {
+		status += " OOMKilled"
+	}
+	return status
+}
@@ -0,0 +1,188 @@
+package command
+
+import (
+	"fmt"
+	"github.com/iverson3/xdocker/cgroups"
+	"github.com/iverson3/xdocker/container"
+	"github.com/iverson3/xdocker/model"
+	"github.com/iverson3/xdocker/network"
+	"github.com/iverson3/xdocker/util"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// ReconcileSystem 校正容器信息与宿主机的实际状态 (xdocker system reconcile)
+// 1. 容器进程已经不存在的容器记为已退出 (读取容器信息时完成)
+// 2. 不再运行的容器：重新挂载丢失的工作空间 (commit/export 需要读取 mnt 目录)，杀死 cgroup 中残留的进程
+// 3. 已经删除的容器：卸载残留的挂载点，杀死 cgroup 中残留的进程并删除 cgroup
+// 4. 回收不属于任何运行中容器的IP地址
+// 正在执行 run/create/start 的容器在记录容器信息之前就已经创建了挂载点、cgroup 和IP地址，
+// 所以执行期间持有容器状态的排它锁 (见 util.LockContainers)，等它们记录完容器信息，也不让新的容器在此期间创建
+func ReconcileSystem() error {
+	unlock, err := util.LockContainers(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	containers, unreadable, err := listContainerInfos()
+	if err != nil {
+		return err
+	}
+
+	known := map[string]bool{}
+	inUse := map[string][]string{}
+	for _, info := range containers {
+		known[info.ID] = true
+		if info.Status == model.RUNNING || info.Status == model.PAUSED || info.Status == model.RESTARTING {
+			if info.NetworkName != "" && info.IpAddress != "" {
+				inUse[info.NetworkName] = append(inUse[info.NetworkName], info.IpAddress)
+			}
+			continue
+		}
+		if err = reconcileStoppedContainer(info); err != nil {
+			fmt.Println(fmt.Errorf("reconcile container %s failed, error: %v", info.Name, err))
+		}
+	}
+
+	// 无法确定读取不了信息的容器占用了哪些挂载点、cgroup 和IP地址，不能把它们当作已经删除的容器的残留来清理
+	if unreadable > 0 {
+		return fmt.Errorf("skipped cleaning up leftovers of removed containers, as the info of %d containers cannot be read", unreadable)
+	}
+
+	if err = reconcileOrphanMounts(known); err != nil {
+		fmt.Println(fmt.Errorf("reconcile mounts failed, error: %v", err))
+	}
+	if err = reconcileOrphanCgroups(known); err != nil {
+		fmt.Println(fmt.Errorf("reconcile cgroups failed, error: %v", err))
+	}
+
+	if err = network.Init(); err != nil {
+		return fmt.Errorf("network init failed, error: %v", err)
+	}
+	released, err := network.ReleaseUnusedIpAddresses(inUse)
+	for networkName, ips := range released {
+		for _, ip := range ips {
+			fmt.Printf("released ip address %s of network %s\n", ip, networkName)
+		}
+	}
+	return err
+}
+
+// 读取所有容器的信息，容器进程已经不存在的容器会被记为已退出
+// 读取失败的容器输出错误之后跳过，返回跳过的容器数量
+func listContainerInfos() ([]*model.ContainerInfo, int, error) {
+	dirUrl := fmt.Sprintf(model.DefaultInfoLocation, "")
+	dirUrl = dirUrl[:len(dirUrl)-1]
+
+	dirs, err := ioutil.ReadDir(dirUrl)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var containers []*model.ContainerInfo
+	unreadable := 0
+	for _, dir := range dirs {
+		info, err := util.GetContainerInfo(dir)
+		if err != nil {
+			fmt.Println(fmt.Errorf("read info of container %s failed, error: %v", dir.Name(), err))
+			unreadable++
+			continue
+		}
+		containers = append(containers, info)
+	}
+	return containers, unreadable, nil
+}
+
+func reconcileStoppedContainer(info *model.ContainerInfo) error {
+	rootUrl, err := util.GetContainerRootPath(info.ID)
+	if err != nil {
+		return err
+	}
+	mntUrl := rootUrl + "mnt/"
+	mounted, err := util.IsMountPoint(mntUrl)
+	if err != nil {
+		return err
+	}
+	if !mounted {
+		err = container.RemountWorkSpace(rootUrl, info.Image, info.Name, mntUrl, info.Volume)
+		if err != nil {
+			return fmt.Errorf("remount workspace failed, error: %v", err)
+		}
+		fmt.Printf("remounted workspace of container %s\n", info.Name)
+	}
+
+	cm := cgroups.NewCgroupManager(fmt.Sprintf(model.DefaultCgroupPath, info.ID))
+	pids, err := cm.Pids()
+	if err != nil {
+		return err
+	}
+	if len(pids) > 0 {
+		if err = killContainer(cm, 0); err != nil {
+			return err
+		}
+		fmt.Printf("killed %d leftover processes of container %s\n", len(pids), info.Name)
+	}
+
+	// 已退出的容器不再占用IP地址，IP地址由 ReleaseUnusedIpAddresses 统一回收
+	if info.IpAddress != "" {
+		info.IpAddress = ""
+		return util.SaveContainerInfo(info)
+	}
+	return nil
+}
+
+// 卸载已经删除的容器残留的挂载点
+func reconcileOrphanMounts(known map[string]bool) error {
+	containerRoot := fmt.Sprintf(model.DefaultContainerRoot, "")
+	containerRoot = containerRoot[:len(containerRoot)-1]
+
+	mountPoints, err := util.MountPoints()
+	if err != nil {
+		return err
+	}
+	var orphans []string
+	for _, mountPoint := range mountPoints {
+		if !strings.HasPrefix(mountPoint, containerRoot) {
+			continue
+		}
+		containerId := strings.SplitN(strings.TrimPrefix(mountPoint, containerRoot), "/", 2)[0]
+		if !known[containerId] {
+			orphans = append(orphans, mountPoint)
+		}
+	}
+
+	// 先卸载数据卷等嵌套的挂载点
+	sort.Sort(sort.Reverse(sort.StringSlice(orphans)))
+	for _, mountPoint := range orphans {
+		if err = syscall.Unmount(mountPoint, syscall.MNT_DETACH); err != nil && err != syscall.EINVAL {
+			return fmt.Errorf("umount %s failed, error: %v", mountPoint, err)
+		}
+		fmt.Printf("unmounted %s\n", mountPoint)
+	}
+	return nil
+}
+
+// 删除已经删除的容器残留的cgroup
+func reconcileOrphanCgroups(known map[string]bool) error {
+	children, err := cgroups.NewCgroupManager(fmt.Sprintf(model.DefaultCgroupPath, "")).Children()
+	if err != nil {
+		return err
+	}
+	for _, containerId := range children {
+		if known[containerId] {
+			continue
+		}
+		cm := cgroups.NewCgroupManager(fmt.Sprintf(model.DefaultCgroupPath, containerId))
+		if err = killContainer(cm, 0); err != nil {
+			return err
+		}
+		if err = cm.Destroy(); err != nil {
+			return err
+		}
+		fmt.Printf("removed cgroup %s\n", cm.Path)
+	}
+	return nil
+}
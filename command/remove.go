@@ -24,17 +24,17 @@ func RemoveContainer(containerFlag string, force bool) error {
 	}
 
 	if force {
-		if info.Status == model.RUNNING {
-			// 强制删除但容器处于运行中，则先停止容器
-			err = StopContainer(containerName)
+		if info.Status == model.RUNNING || info.Status == model.PAUSED || info.Status == model.RESTARTING {
+			// 强制删除但容器处于运行中，则先停止容器 (不等待容器进程自行退出，直接强制杀死)
+			err = StopContainer(containerName, 0)
 			if err != nil {
 				fmt.Println(fmt.Errorf("stop container failed, error: %v", err))
 				return err
 			}
 		}
 	} else {
-		// 非强制删除 只能删除已经停止运行的容器
-		if info.Status != model.STOP {
+		// 非强制删除 只能删除已经停止运行、已经退出或者还没有启动过的容器
+		if info.Status != model.STOP && info.Status != model.EXIT && info.Status != model.CREATED {
 			return fmt.Errorf("don't remove not stopped container")
 		}
 	}
@@ -1,7 +1,7 @@
 package command
 
-func ReStartContainer(containerFlag string) error {
-	err := StopContainer(containerFlag)
+func ReStartContainer(containerFlag string, timeout int) error {
+	err := StopContainer(containerFlag, timeout)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,76 @@
+package command
+
+import (
+	"fmt"
+	"github.com/iverson3/xdocker/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// 自动重启的退避时间：从 100ms 开始每次翻倍，最多 1 分钟
+	restartBackoffMin = 100 * time.Millisecond
+	restartBackoffMax = time.Minute
+	// 容器运行超过该时间之后再退出，认为之前的重启已经成功，退避时间重新从最小值开始
+	restartBackoffReset = 10 * time.Second
+)
+
+// ParseRestartPolicy 解析重启策略 no|on-failure[:N]|always|unless-stopped
+// 返回策略名和最大重启次数 (只有 on-failure 可以设置，0 表示不限制)
+func ParseRestartPolicy(policy string) (string, int, error) {
+	if policy == "" {
+		return model.RestartPolicyNo, 0, nil
+	}
+
+	parts := strings.SplitN(policy, ":", 2)
+	name := parts[0]
+	switch name {
+	case model.RestartPolicyNo, model.RestartPolicyAlways, model.RestartPolicyUnlessStopped:
+		if len(parts) == 2 {
+			return "", 0, fmt.Errorf("maximum retry count cannot be used with restart policy '%s'", name)
+		}
+		return name, 0, nil
+	case model.RestartPolicyOnFailure:
+		if len(parts) == 1 {
+			return name, 0, nil
+		}
+		maxRetries, err := strconv.Atoi(parts[1])
+		if err != nil || maxRetries < 0 {
+			return "", 0, fmt.Errorf("invalid maximum retry count: %s", parts[1])
+		}
+		return name, maxRetries, nil
+	default:
+		return "", 0, fmt.Errorf("invalid restart policy: %s", policy)
+	}
+}
+
+// shouldRestart 根据容器的重启策略判断容器退出之后是否需要自动重启
+// 被用户手动停止的容器不会自动重启；退出码未知 (-1) 时无法判断是否失败，on-failure 策略不重启
+func shouldRestart(info *model.ContainerInfo, exitCode, restartCount int) bool {
+	if info.ManuallyStopped {
+		return false
+	}
+
+	name, maxRetries, err := ParseRestartPolicy(info.RestartPolicy)
+	if err != nil {
+		return false
+	}
+	switch name {
+	case model.RestartPolicyAlways, model.RestartPolicyUnlessStopped:
+		return true
+	case model.RestartPolicyOnFailure:
+		return exitCode > 0 && (maxRetries == 0 || restartCount < maxRetries)
+	default:
+		return false
+	}
+}
+
+// nextBackoff 计算下一次重启前需要等待的时间
+func nextBackoff(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > restartBackoffMax {
+		delay = restartBackoffMax
+	}
+	return delay
+}
@@ -0,0 +1,40 @@
+package command
+
+import (
+	"github.com/iverson3/xdocker/model"
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	name, maxRetries, err := ParseRestartPolicy("on-failure:3")
+	assert.NilError(t, err)
+	assert.Equal(t, model.RestartPolicyOnFailure, name)
+	assert.Equal(t, 3, maxRetries)
+
+	name, _, err = ParseRestartPolicy("")
+	assert.NilError(t, err)
+	assert.Equal(t, model.RestartPolicyNo, name)
+
+	for _, policy := range []string{"always", "unless-stopped", "no", "on-failure"} {
+		_, _, err = ParseRestartPolicy(policy)
+		assert.NilError(t, err, policy)
+	}
+	for _, policy := range []string{"sometimes", "always:3", "on-failure:-1", "on-failure:x"} {
+		_, _, err = ParseRestartPolicy(policy)
+		assert.Assert(t, err != nil, policy)
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	info := &model.ContainerInfo{RestartPolicy: "on-failure:2"}
+	assert.Assert(t, shouldRestart(info, 1, 0))
+	assert.Assert(t, !shouldRestart(info, 0, 0))
+	assert.Assert(t, !shouldRestart(info, 1, 2))
+	assert.Assert(t, !shouldRestart(info, -1, 0))
+
+	info = &model.ContainerInfo{RestartPolicy: "always"}
+	assert.Assert(t, shouldRestart(info, 0, 100))
+	info.ManuallyStopped = true
+	assert.Assert(t, !shouldRestart(info, 0, 0))
+}
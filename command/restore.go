@@ -0,0 +1,79 @@
+package command
+
+import (
+	"fmt"
+	"github.com/iverson3/xdocker/model"
+	"github.com/iverson3/xdocker/util"
+	"io/ioutil"
+)
+
+// RestoreContainers 宿主机重启之后按照重启策略恢复容器，一般在系统启动时执行一次 (见 xdocker-restore.service)
+// 宿主机重启之后，容器信息中记录的运行中的容器其实都已经不存在了，需要先校正容器状态 (见 ReconcileSystem)，再根据重启策略决定是否启动：
+// always 总是启动；unless-stopped 只要不是被手动停止的就启动；on-failure 只启动宿主机重启前还在运行的容器
+func RestoreContainers() error {
+	dirUrl := fmt.Sprintf(model.DefaultInfoLocation, "")
+	dirUrl = dirUrl[:len(dirUrl)-1]
+
+	dirs, err := ioutil.ReadDir(dirUrl)
+	if err != nil {
+		return err
+	}
+
+	// 先根据校正之前的容器信息找出宿主机重启前还在运行的容器
+	stale := map[string]bool{}
+	for _, dir := range dirs {
+		info, err := util.LoadContainerInfo(dir.Name())
+		if err != nil {
+			fmt.Println(fmt.Errorf("restore: read info of container %s failed, error: %v", dir.Name(), err))
+			continue
+		}
+		running := info.Status == model.RUNNING || info.Status == model.PAUSED || info.Status == model.RESTARTING
+		stale[info.Name] = running && !util.ContainerProcessIsAlive(info) && !util.ShimIsAlive(info.Name)
+	}
+
+	// 将这些容器记为已退出 (退出码未知)，并重新挂载工作空间、回收残留的IP地址占用
+	if err = ReconcileSystem(); err != nil {
+		fmt.Println(fmt.Errorf("restore: reconcile failed, error: %v", err))
+	}
+
+	for _, dir := range dirs {
+		info, err := util.GetContainerInfo(dir)
+		if err != nil {
+			// 读取失败的错误在上面已经输出过了
+			continue
+		}
+
+		// 容器进程依然存在 (没有经过重启)，或者是还没有启动过的容器，不需要恢复
+		if info.Status != model.EXIT && info.Status != model.STOP {
+			continue
+		}
+		if !shouldRestore(info, stale[info.Name]) {
+			continue
+		}
+		err = startContainerWithShim(info.Name, info.RestartCount)
+		if err != nil {
+			fmt.Println(fmt.Errorf("restore: start container %s failed, error: %v", info.Name, err))
+			continue
+		}
+		fmt.Println(info.Name)
+	}
+	return nil
+}
+
+// shouldRestore 判断宿主机重启之后是否需要启动容器，stale 表示宿主机重启前容器还在运行
+func shouldRestore(info *model.ContainerInfo, stale bool) bool {
+	name, _, err := ParseRestartPolicy(info.RestartPolicy)
+	if err != nil {
+		return false
+	}
+	switch name {
+	case model.RestartPolicyAlways:
+		return true
+	case model.RestartPolicyUnlessStopped:
+		return !info.ManuallyStopped
+	case model.RestartPolicyOnFailure:
+		return stale
+	default:
+		return false
+	}
+}
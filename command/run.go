@@ -3,70 +3,154 @@ package command
 import (
 	"fmt"
 	"github.com/iverson3/xdocker/cgroups"
-	"github.com/iverson3/xdocker/cgroups/subsystems"
 	"github.com/iverson3/xdocker/container"
 	"github.com/iverson3/xdocker/model"
 	"github.com/iverson3/xdocker/network"
 	"github.com/iverson3/xdocker/util"
+	"io"
+	"net"
 	"os"
 	"os/signal"
 	"strconv"
-	"strings"
 	"syscall"
 )
 
-func Run(tty, detach bool, containerCmd []string, res *subsystems.ResourceConfig, volume, imageName, containerName string, envSlice []string, networkName string, portMapping []string) {
+// xdocker 自身出错导致容器没能运行起来时 run 的退出码 (与 docker 一致)
+const runFailedExitCode = 125
+
+// Run 创建并运行容器，返回前台运行的容器的退出码 (后台运行的容器返回0)
+func Run(detach bool, opts *ContainerOptions) int {
+	// 使用终端的前台容器同样由 shim 运行，当前进程 attach 到容器的终端
+	// 这样按下 detach keys 之后容器可以继续在后台运行，之后再通过 attach 连接
+	if opts.Tty && !detach {
+		return runAttached(opts)
+	}
+	containerId, _, exitCode := runContainer(detach, opts, nil)
+	if detach && exitCode == 0 {
+		fmt.Println(containerId)
+	}
+	return exitCode
+}
+
+// runAttached 在后台运行容器并 attach 到它的终端，容器退出时与之前的前台容器一样删除容器
+func runAttached(opts *ContainerOptions) int {
+	keys, err := parseDetachKeys(defaultDetachKeys)
+	if err != nil {
+		fmt.Println(err)
+		return runFailedExitCode
+	}
+	// 在容器命令开始运行之前连接到容器的终端，不会错过容器一开始的输出
+	var conn net.Conn
+	var output io.Reader
+	_, containerName, exitCode := runContainer(true, opts, func(containerName string) error {
+		conn, output, err = dialAttach(containerName)
+		return err
+	})
+	if exitCode != 0 {
+		if conn != nil {
+			conn.Close()
+		}
+		return exitCode
+	}
+	exitCode, detached, err := streamAttach(containerName, conn, output, keys)
+	if err != nil {
+		fmt.Println(err)
+		return runFailedExitCode
+	}
+	if detached {
+		return 0
+	}
+
+	info, err := util.GetContainerInfoByName(containerName)
+	if err == nil && info.OOMKilled {
+		fmt.Println("container was killed because it ran out of memory")
+	}
+	// 容器按照重启策略正在重启时不删除
+	if err == nil && (info.Status == model.EXIT || info.Status == model.STOP) {
+		if err = RemoveContainer(containerName, false); err != nil {
+			fmt.Println(err)
+		}
+	}
+	return exitCode
+}
+
+// runContainer 创建并运行容器，返回容器ID、容器名和前台运行的容器的退出码
+// shimStarted 不为 nil 时在 shim 启动之后、容器命令开始运行之前调用
+func runContainer(detach bool, opts *ContainerOptions, shimStarted func(containerName string) error) (string, string, int) {
+	tty, res, volume, imageName := opts.Tty, opts.Resource, opts.Volume, opts.Image
+	networkName, portMapping := opts.Network, opts.PortMapping
 	// 是否需要释放资源
 	var needRelease = true
+	// 容器进程是否已经退出
+	var exited = false
+	// 前台运行的容器的退出码，作为 xdocker run 的退出码
+	var exitCode = 0
+	// 记录容器信息之前持有容器状态的共享锁，避免 system reconcile 将创建了一半的容器当作残留清理掉
+	// 回滚也在持有锁的时候完成，所以释放锁的defer需要放在最前面
+	unlock, err := util.LockContainers(false)
+	if err != nil {
+		fmt.Println(err)
+		return "", "", runFailedExitCode
+	}
+	defer unlock()
+
 	// 生成随机的容器ID
 	containerId := util.RandStringBytes(10)
-	// 如果没传容器名，则将容器ID作为容器名
-	if containerName == "" {
-		containerName = containerId
-	} else {
-		// 检查容器名是否重名
-		exists, err := util.ContainerIsExistsByName(containerName)
-		if err != nil {
-			fmt.Println(fmt.Errorf("unknown error: %v", err))
-			return
-		}
-		if exists {
-			fmt.Println("duplicate container name")
-			return
-		}
+	// 如果没传容器名，则将容器ID作为容器名，否则检查容器名是否重名
+	containerName, err := newContainerName(containerId, opts.Name)
+	if err != nil {
+		fmt.Println(err)
+		return "", "", runFailedExitCode
 	}
 
 	// 不再使用当前路径作为容器运行的根目录，而是使用某个固定的目录+容器ID组成的目录
 	rootUrl, err := util.GetContainerRootPath(containerId)
 	if err != nil {
-		return
+		return "", "", runFailedExitCode
 	}
 	mntUrl := rootUrl + "mnt/"
 
 	// 将新建的只读层和可写层进行隔离
-	initProcess, writePipe := container.NewParentProcess(false, tty, detach, containerId, containerName, imageName, rootUrl, mntUrl, volume, envSlice)
+	initProcess, writePipe := container.NewParentProcess(false, containerId, containerName, imageName, rootUrl, mntUrl, volume)
 	if initProcess == nil || writePipe == nil {
 		fmt.Println("new parent process failed")
 		// todo: 需要做清理工作，比如删除创建的workspace
 		// 但要注意此时workspace可能还没创建 或者 mnt目录还没进行挂载或挂载失败
 		// 所以在清理工作之前需要相应的进行判断
-		return
+		return "", "", runFailedExitCode
 	}
 
-	if err := initProcess.Start(); err != nil {
-		fmt.Println(fmt.Errorf("ERROR: %v", err))
-		// 如果fork进程出现异常，由于mnt已经进行挂载 工作目录已经创建，需要进行清理
-		container.DeleteWorkSpace(rootUrl, mntUrl, volume)
-		return
+	// 后台运行的容器进程由 shim 进程启动，shim 作为容器进程的父进程负责等待容器退出并记录退出状态
+	// 前台运行的容器进程则由当前进程直接启动并等待其退出
+	var pid int
+	if detach {
+		shim, err := container.StartShim(containerName, initProcess, tty)
+		if err != nil {
+			fmt.Println(fmt.Errorf("ERROR: %v", err))
+			container.DeleteWorkSpace(rootUrl, mntUrl, volume)
+			return "", "", runFailedExitCode
+		}
+		pid = shim.InitPid
+		// 所有的设置完成 (或者回滚) 之后再通知 shim，所以这个defer需要放在最前面
+		defer shim.Ready()
+	} else {
+		if err := initProcess.Start(); err != nil {
+			fmt.Println(fmt.Errorf("ERROR: %v", err))
+			// 如果fork进程出现异常，由于mnt已经进行挂载 工作目录已经创建，需要进行清理
+			container.DeleteWorkSpace(rootUrl, mntUrl, volume)
+			return "", "", runFailedExitCode
+		}
+		pid = initProcess.Process.Pid
 	}
 	// 自此往后，任何一个步骤出错了，在函数返回之前都要把之前已完成的步骤回滚
 	// 回滚处理：释放ip地址 删除容器信息 删除容器id容器名的映射 删除cgroup的相关目录 结束已经运行起来的容器进程 删除容器工作空间 取消mnt挂载
 	defer func() {
 		if needRelease {
 			// 先kill容器进程，再清理容器挂载点和工作空间（镜像层 读写层 mnt）
-			// 如果容器不是后台运行，则不需要kill容器进程，因为前台的容器进程退出了代码才会运行到这里，此时容器进程已经退出了，不需要再进行kill
-			if detach {
-				err = syscall.Kill(initProcess.Process.Pid, syscall.SIGTERM)
+			// 前台的容器进程正常退出后代码才会运行到这里，此时容器进程已经退出了，不需要再进行kill
+			// 但如果是中途某个步骤出错了，则不管是否后台运行，容器进程都还在运行，需要kill掉
+			if !exited {
+				err = syscall.Kill(pid, syscall.SIGTERM)
 				if err != nil {
 					fmt.Println(fmt.Errorf("kill container process failed, error: %v", err))
 				}
@@ -80,16 +164,13 @@ func Run(tty, detach bool, containerCmd []string, res *subsystems.ResourceConfig
 		}
 	}()
 
-	// 将命令参数发送给容器进程
-	sendInitCommand(containerCmd, writePipe)
-
 	// 创建资源管理器，进行资源限制的设置
 	cGroupPath := fmt.Sprintf(model.DefaultCgroupPath, containerId)
 	cm := cgroups.NewCgroupManager(cGroupPath)
 	err = cm.Set(res)
 	if err != nil {
 		fmt.Println(fmt.Errorf("cgroup set resource-limit failed, error: %v", err))
-		return
+		return "", "", runFailedExitCode
 	}
 	defer func() {
 		if needRelease {
@@ -100,10 +181,30 @@ func Run(tty, detach bool, containerCmd []string, res *subsystems.ResourceConfig
 			}
 		}
 	}()
-	err = cm.AddProcess(initProcess.Process.Pid)
+	err = cm.AddProcess(pid)
 	if err != nil {
 		fmt.Println(fmt.Errorf("cgroup addProcess failed, error: %v", err))
-		return
+		return "", "", runFailedExitCode
+	}
+
+	if shimStarted != nil {
+		if err = shimStarted(containerName); err != nil {
+			fmt.Println(err)
+			return "", "", runFailedExitCode
+		}
+	}
+
+	// 容器进程加入cgroup之后再将命令参数发送给容器进程，保证用户命令一开始运行就受到资源限制
+	baseInfo := opts.containerInfo(containerId, containerName)
+	initConfig, err := initConfigWithEtcFiles(rootUrl, baseInfo)
+	if err != nil {
+		fmt.Println(err)
+		return "", "", runFailedExitCode
+	}
+	err = container.SendInitConfig(writePipe, initConfig)
+	if err != nil {
+		fmt.Println(fmt.Errorf("send init config failed, error: %v", err))
+		return "", "", runFailedExitCode
 	}
 
 	// todo: xxx
@@ -116,10 +217,10 @@ func Run(tty, detach bool, containerCmd []string, res *subsystems.ResourceConfig
 		err = network.Init()
 		if err != nil {
 			fmt.Println(fmt.Errorf("network init failed, error: %v", err))
-			return
+			return "", "", runFailedExitCode
 		} else {
 			containerInfo := &model.ContainerInfo{
-				Pid:         strconv.Itoa(initProcess.Process.Pid),
+				Pid:         strconv.Itoa(pid),
 				ID:          containerId,
 				Name:        containerName,
 				PortMapping: portMapping,
@@ -127,7 +228,13 @@ func Run(tty, detach bool, containerCmd []string, res *subsystems.ResourceConfig
 			ipAddress, err = network.Connect(networkName, containerInfo)
 			if err != nil {
 				fmt.Println(fmt.Errorf("network connect failed, network: %s, containerInfo: %v, error: %v", networkName, containerInfo, err))
-				return
+				return "", "", runFailedExitCode
+			}
+			// 分配到IP地址之后在 hosts 文件中加上容器自己的主机名
+			err = container.WriteHostsFile(rootUrl, baseInfo, ipAddress)
+			if err != nil {
+				fmt.Println(err)
+				return "", "", runFailedExitCode
 			}
 		}
 	}
@@ -144,10 +251,11 @@ func Run(tty, detach bool, containerCmd []string, res *subsystems.ResourceConfig
 	}
 
 	// 记录容器信息
-	err = container.RecordContainerInfo(initProcess.Process.Pid, containerCmd, containerId, containerName, imageName, volume, networkName, ipAddress, portMapping)
+	info := runningContainerInfo(opts, containerId, containerName, pid, ipAddress)
+	err = container.RecordContainerInfo(info)
 	if err != nil {
 		fmt.Println(fmt.Errorf("run: record container info failed, error: %v", err))
-		return
+		return "", "", runFailedExitCode
 	}
 	defer func() {
 		if needRelease {
@@ -160,7 +268,7 @@ func Run(tty, detach bool, containerCmd []string, res *subsystems.ResourceConfig
 	err = util.AddContainerMapping(containerId, containerName)
 	if err != nil {
 		fmt.Println(fmt.Errorf("run: add containerId - containerName mapping failed, error: %v", err))
-		return
+		return "", "", runFailedExitCode
 	}
 	defer func() {
 		if needRelease {
@@ -171,6 +279,8 @@ func Run(tty, detach bool, containerCmd []string, res *subsystems.ResourceConfig
 			}
 		}
 	}()
+	// 容器信息已经记录下来了，前台运行的容器不能在等待容器退出期间一直持有锁
+	unlock()
 
 	//exitCh := make(chan struct{}, 1)
 	// 监听退出信号 ctrl+c，但 ctrl+c好像不会执行defer，所以需要将所有相关资源全部释放
@@ -178,26 +288,37 @@ func Run(tty, detach bool, containerCmd []string, res *subsystems.ResourceConfig
 	//go watchKillSignal(exitCh)
 
 	if !detach {
+		// 前台运行的容器由当前进程监听OOM事件
+		watcher := newOOMWatcher(&model.ContainerInfo{ID: containerId, Name: containerName}, cm)
+		// 前台运行的容器由当前进程进行健康检查
+		checker := startHealthCheck(info, pid)
 		// 如果detach为false 则父进程一直等待容器进程的退出
 		_ = initProcess.Wait()
+		checker.Stop()
+		exited = true
+		exitCode = exitCodeOf(initProcess.ProcessState)
+		killed := watcher.Killed()
+		if killed {
+			fmt.Println("container was killed because it ran out of memory")
+		}
+		recordDieEvent(&model.ContainerInfo{ID: containerId, Name: containerName}, exitCode, killed)
 		//exitCh <- struct{}{}
 		// 非后台容器进程，在容器退出的时候，要删除相关的文件目录  docker是这样做的
 		// 而对于后台容器进程，则是在删除容器的时候再删除相关的文件目录
 		// 资源释放放在每一步资源设置后的defer中进行
 	}
 
-	// detach为true，则父进程直接退出，容器进程成为孤儿进程，让init进程进行接管，由此成为后台进程
+	// detach为true，则父进程直接退出，容器进程由 shim 进程接管，由此成为后台进程
 	if detach {
 		// 容器后台运行则不需要清理资源
 		needRelease = false
-		fmt.Println(containerId)
 	}
 	//os.Exit(-1)
-	return
+	return containerId, containerName, exitCode
 }
 
 func watchKillSignal(exitCh chan struct{}) {
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	// 监听指定的信号
 	signal.Notify(ch, os.Kill, os.Interrupt, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGABRT)
 
@@ -212,13 +333,3 @@ func watchKillSignal(exitCh chan struct{}) {
 		signal.Stop(ch)
 	}
 }
-
-func sendInitCommand(containerCmd []string, writePipe *os.File)  {
-	cmdString := strings.Join(containerCmd, " ")
-
-	// 向 writePipe 写入参数，这样容器就会获取到参数
-	writePipe.WriteString(cmdString)
-	// 关闭 pipe，使得 init 进程继续运行
-	writePipe.Close()
-}
-
@@ -0,0 +1,328 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/iverson3/xdocker/cgroups"
+	"github.com/iverson3/xdocker/container"
+	"github.com/iverson3/xdocker/model"
+	"github.com/iverson3/xdocker/util"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 通过控制socket与 shim 进程通信的超时时间
+const shimRequestTimeout = 5 * time.Second
+
+// containerShim 容器的 shim 进程，是后台运行的容器的 init 进程的父进程
+// 负责等待容器进程退出、记录退出状态、关闭日志文件、释放IP地址，并根据重启策略重启容器
+// 同时监听控制socket，接收给容器进程发送信号、调整终端大小和 attach 到容器终端的请求
+type containerShim struct {
+	name  string
+	mu    sync.Mutex
+	pid   int           // 容器进程的pid，0 表示容器进程没有在运行
+	relay *consoleRelay // 容器终端的转发，没有终端的容器为 nil
+}
+
+// ShimContainer shim 进程的入口 (由 run/start 通过 container.StartShim 在后台启动)
+func ShimContainer(containerName string, tty bool) error {
+	shimInit, err := container.NewShimInit(tty)
+	if err != nil {
+		return err
+	}
+
+	// 在启动容器进程之前开始监听控制socket，run -it 在容器命令开始运行之前就可以连接到容器的终端
+	// 连接会在 socket 的队列中等待，直到下面开始处理请求
+	s := &containerShim{name: containerName}
+	listener, listenErr := s.listen()
+	if listenErr != nil {
+		fmt.Println(fmt.Errorf("shim listen control socket failed, error: %v", listenErr))
+	} else {
+		defer listener.Close()
+	}
+
+	if err = shimInit.Start(); err != nil {
+		return err
+	}
+	initProcess := shimInit.Cmd
+	closeLog := shimInit.CloseLog
+
+	s.setPid(initProcess.Process.Pid)
+	if shimInit.ConsoleSocket != nil {
+		relay := newConsoleRelay(shimInit.Log)
+		s.setRelay(relay)
+		go relay.receive(shimInit.ConsoleSocket)
+	}
+	if listenErr == nil {
+		go s.serve(listener)
+	}
+
+	// 等待 xdocker 完成 cgroup、网络和容器信息的设置
+	shimInit.WaitReady()
+	info, err := util.GetContainerInfoByName(containerName)
+	if err != nil || info.Pid != strconv.Itoa(initProcess.Process.Pid) {
+		// 启动流程出错被回滚了，容器进程已经被kill
+		_ = initProcess.Wait()
+		closeLog()
+		s.setRelay(nil)
+		return nil
+	}
+
+	cm := cgroups.NewCgroupManager(fmt.Sprintf(model.DefaultCgroupPath, info.ID))
+	watcher := newOOMWatcher(info, cm)
+	checker := startHealthCheck(info, initProcess.Process.Pid)
+
+	restartCount := info.RestartCount
+	delay := restartBackoffMin
+	for {
+		startedAt := time.Now()
+		_ = initProcess.Wait()
+		pid := initProcess.Process.Pid
+		exitCode := exitCodeOf(initProcess.ProcessState)
+		s.setPid(0)
+		checker.Stop()
+		// 先把容器终端中剩余的输出写入日志和 attach 的客户端
+		s.getRelay().Drain()
+		closeLog()
+
+		oomKilled := watcher.Killed()
+		err = recordContainerExit(containerName, pid, exitCode, oomKilled)
+		// 记录退出状态之后再断开 attach 的客户端，客户端据此获取退出码
+		s.setRelay(nil)
+		if err != nil {
+			return err
+		}
+
+		// 容器已经被stop、重新start或者删除了，则不再需要重启
+		info, err = util.GetContainerInfoByName(containerName)
+		if err != nil || info.Status != model.EXIT || !shouldRestart(info, exitCode, restartCount) {
+			return nil
+		}
+
+		if time.Since(startedAt) >= restartBackoffReset {
+			delay = restartBackoffMin
+		}
+		info.Status = model.RESTARTING
+		if err = util.SaveContainerInfo(info); err != nil {
+			return err
+		}
+		time.Sleep(delay)
+		delay = nextBackoff(delay)
+
+		// 等待期间容器可能被stop或者删除了
+		info, err = util.GetContainerInfoByName(containerName)
+		if err != nil || info.Status != model.RESTARTING {
+			return nil
+		}
+
+		// 重启的容器进程由 shim 直接启动，依然是 shim 的子进程
+		restartCount++
+		var logFile *os.File
+		_, err = startContainer(containerName, restartCount, func(cmd *exec.Cmd, info *model.ContainerInfo) (int, error) {
+			logFile, _ = cmd.Stdout.(*os.File)
+			var consoleSocket, child *os.File
+			if info.Tty {
+				var err error
+				if consoleSocket, child, err = container.NewConsoleSocket(cmd); err != nil {
+					return 0, err
+				}
+				defer child.Close()
+			}
+			if err := cmd.Start(); err != nil {
+				if consoleSocket != nil {
+					consoleSocket.Close()
+				}
+				return 0, err
+			}
+			initProcess = cmd
+			if consoleSocket != nil {
+				relay := newConsoleRelay(logFile)
+				s.setRelay(relay)
+				go relay.receive(consoleSocket)
+			}
+			return cmd.Process.Pid, nil
+		})
+		if err != nil {
+			info.Status = model.EXIT
+			_ = util.SaveContainerInfo(info)
+			return fmt.Errorf("restart container failed, error: %v", err)
+		}
+		closeLog = func() {
+			if logFile != nil {
+				logFile.Close()
+			}
+		}
+		s.setPid(initProcess.Process.Pid)
+		watcher.Reset()
+		checker = startHealthCheck(info, initProcess.Process.Pid)
+		err = util.RecordEvent(model.EventRestart, info.ID, info.Name, map[string]string{
+			"restartCount": strconv.Itoa(restartCount),
+		})
+		if err != nil {
+			fmt.Println(fmt.Errorf("record restart event failed, error: %v", err))
+		}
+	}
+}
+
+// startContainerWithShim 启动一个新的 shim 进程，并由它启动容器进程
+func startContainerWithShim(containerName string, restartCount int) error {
+	var shim *container.Shim
+	_, err := startContainer(containerName, restartCount, func(initProcess *exec.Cmd, info *model.ContainerInfo) (int, error) {
+		var err error
+		shim, err = container.StartShim(containerName, initProcess, info.Tty)
+		if err != nil {
+			return 0, err
+		}
+		return shim.InitPid, nil
+	})
+	if shim != nil {
+		shim.Ready()
+	}
+	return err
+}
+
+func (s *containerShim) setPid(pid int) {
+	s.mu.Lock()
+	s.pid = pid
+	s.mu.Unlock()
+}
+
+func (s *containerShim) getPid() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pid
+}
+
+// 设置当前容器进程的终端转发，之前的转发会被关闭
+func (s *containerShim) setRelay(relay *consoleRelay) {
+	s.mu.Lock()
+	old := s.relay
+	s.relay = relay
+	s.mu.Unlock()
+	old.Close()
+}
+
+func (s *containerShim) getRelay() *consoleRelay {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.relay
+}
+
+// 监听控制socket，socket文件放在容器信息目录下
+func (s *containerShim) listen() (net.Listener, error) {
+	socketPath := util.ShimSocketPath(s.name)
+	// 清理上一个 shim 残留的socket文件 (比如宿主机重启之后)
+	_ = os.Remove(socketPath)
+	return net.Listen("unix", socketPath)
+}
+
+func (s *containerShim) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// 每个连接处理一个请求
+func (s *containerShim) handleConn(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(shimRequestTimeout))
+
+	var req model.ShimRequest
+	var resp model.ShimResponse
+	err := json.NewDecoder(conn).Decode(&req)
+	if err == nil && req.Action == model.ShimActionAttach {
+		s.handleAttach(conn)
+		return
+	}
+	if err == nil {
+		err = s.handleRequest(&req)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	_ = json.NewEncoder(conn).Encode(&resp)
+}
+
+func (s *containerShim) handleRequest(req *model.ShimRequest) error {
+	switch req.Action {
+	case model.ShimActionSignal:
+		pid := s.getPid()
+		if pid == 0 {
+			return fmt.Errorf("container is not running")
+		}
+		return syscall.Kill(pid, syscall.Signal(req.Signal))
+	case model.ShimActionResize:
+		relay := s.getRelay()
+		if relay == nil {
+			return fmt.Errorf("container has no tty")
+		}
+		return relay.Resize(req.Width, req.Height)
+	default:
+		return fmt.Errorf("unknown shim action: %s", req.Action)
+	}
+}
+
+// 将连接转为容器终端的输入输出，直到容器进程退出或者客户端断开连接
+func (s *containerShim) handleAttach(conn net.Conn) {
+	var resp model.ShimResponse
+	relay := s.getRelay()
+	if relay == nil {
+		resp.Error = "container has no tty or is not running"
+	}
+	if err := json.NewEncoder(conn).Encode(&resp); err != nil || relay == nil {
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	relay.Attach(conn)
+}
+
+// dialShim 连接容器 shim 进程的控制socket
+func dialShim(containerName string) (net.Conn, error) {
+	return net.DialTimeout("unix", util.ShimSocketPath(containerName), shimRequestTimeout)
+}
+
+// sendShimRequest 向容器的 shim 进程发送一个控制请求并等待响应
+func sendShimRequest(conn net.Conn, req *model.ShimRequest) error {
+	_ = conn.SetDeadline(time.Now().Add(shimRequestTimeout))
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return err
+	}
+
+	var resp model.ShimResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	return nil
+}
+
+// signalContainer 通过 shim 给容器进程发送信号
+// 没有 shim 的容器 (比如旧版本启动的容器) 直接给容器进程发送信号
+func signalContainer(info *model.ContainerInfo, sig syscall.Signal) error {
+	conn, err := dialShim(info.Name)
+	if err != nil {
+		pid, err := strconv.Atoi(info.Pid)
+		if err != nil {
+			return err
+		}
+		return syscall.Kill(pid, sig)
+	}
+	defer conn.Close()
+
+	return sendShimRequest(conn, &model.ShimRequest{
+		Action: model.ShimActionSignal,
+		Signal: int(sig),
+	})
+}
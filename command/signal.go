@@ -0,0 +1,59 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// 支持通过名字指定的信号
+var signalMap = map[string]syscall.Signal{
+	"ABRT":   syscall.SIGABRT,
+	"ALRM":   syscall.SIGALRM,
+	"BUS":    syscall.SIGBUS,
+	"CHLD":   syscall.SIGCHLD,
+	"CONT":   syscall.SIGCONT,
+	"FPE":    syscall.SIGFPE,
+	"HUP":    syscall.SIGHUP,
+	"ILL":    syscall.SIGILL,
+	"INT":    syscall.SIGINT,
+	"IO":     syscall.SIGIO,
+	"KILL":   syscall.SIGKILL,
+	"PIPE":   syscall.SIGPIPE,
+	"PROF":   syscall.SIGPROF,
+	"PWR":    syscall.SIGPWR,
+	"QUIT":   syscall.SIGQUIT,
+	"SEGV":   syscall.SIGSEGV,
+	"STOP":   syscall.SIGSTOP,
+	"SYS":    syscall.SIGSYS,
+	"TERM":   syscall.SIGTERM,
+	"TRAP":   syscall.SIGTRAP,
+	"TSTP":   syscall.SIGTSTP,
+	"TTIN":   syscall.SIGTTIN,
+	"TTOU":   syscall.SIGTTOU,
+	"URG":    syscall.SIGURG,
+	"USR1":   syscall.SIGUSR1,
+	"USR2":   syscall.SIGUSR2,
+	"VTALRM": syscall.SIGVTALRM,
+	"WINCH":  syscall.SIGWINCH,
+	"XCPU":   syscall.SIGXCPU,
+	"XFSZ":   syscall.SIGXFSZ,
+}
+
+// ParseSignal 解析信号，支持信号名 (SIGTERM 或者 TERM，不区分大小写) 和信号值 (比如 15)
+func ParseSignal(signal string) (syscall.Signal, error) {
+	if num, err := strconv.Atoi(signal); err == nil {
+		if num <= 0 || num > 64 {
+			return 0, fmt.Errorf("invalid signal: %s", signal)
+		}
+		return syscall.Signal(num), nil
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(signal), "SIG")
+	sig, ok := signalMap[name]
+	if !ok {
+		return 0, fmt.Errorf("invalid signal: %s", signal)
+	}
+	return sig, nil
+}
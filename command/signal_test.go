@@ -0,0 +1,24 @@
+package command
+
+import (
+	"gotest.tools/assert"
+	"syscall"
+	"testing"
+)
+
+func TestParseSignal(t *testing.T) {
+	for _, signal := range []string{"SIGTERM", "TERM", "sigterm", "15"} {
+		sig, err := ParseSignal(signal)
+		assert.NilError(t, err, signal)
+		assert.Equal(t, syscall.SIGTERM, sig, signal)
+	}
+
+	sig, err := ParseSignal("SIGKILL")
+	assert.NilError(t, err)
+	assert.Equal(t, syscall.SIGKILL, sig)
+
+	for _, signal := range []string{"", "SIGFOO", "0", "-1", "65"} {
+		_, err = ParseSignal(signal)
+		assert.Assert(t, err != nil, signal)
+	}
+}
@@ -4,19 +4,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/iverson3/xdocker/cgroups"
+	"github.com/iverson3/xdocker/cgroups/subsystems"
+	"github.com/iverson3/xdocker/config"
 	"github.com/iverson3/xdocker/container"
 	"github.com/iverson3/xdocker/model"
 	"github.com/iverson3/xdocker/network"
 	"github.com/iverson3/xdocker/util"
 	"io/ioutil"
+	"os/exec"
 	"strconv"
-	"strings"
 	"syscall"
+	"time"
 )
 
-// StartContainer 启动一个已经被停止的容器
+// StartContainer 启动一个已经被停止的容器或者通过 create 创建的容器
 func StartContainer(containerFlag string) error {
-	var needRelease = true
 	exists, containerName, err := util.ContainerIsExists(containerFlag)
 	if err != nil {
 		return err
@@ -29,49 +31,104 @@ func StartContainer(containerFlag string) error {
 	if err != nil {
 		return err
 	}
+	if info.Status == model.RESTARTING {
+		return fmt.Errorf("container is restarting, stop it first")
+	}
+	// 宿主机重启之后容器信息中可能残留 running 状态，此时容器进程已经不存在了，可以再次启动
+	if (info.Status == model.RUNNING || info.Status == model.PAUSED) && util.ContainerProcessIsAlive(info) {
+		return fmt.Errorf("container is already running")
+	}
+
+	// 手动启动容器时重置重启次数，容器进程由新的 shim 进程启动和监控
+	return startContainerWithShim(containerName, 0)
+}
+
+// initLauncher 启动由 NewParentProcess 创建的容器进程，返回容器进程的pid
+type initLauncher func(initProcess *exec.Cmd, info *model.ContainerInfo) (int, error)
+
+// startContainer 重新创建容器进程、cgroup和网络，并更新容器信息
+// 手动启动和按照重启策略自动重启都走这个流程，restartCount 为启动之后记录的重启次数
+// 手动启动时由新的 shim 进程启动容器进程，自动重启时由 shim 直接启动，launch 决定容器进程的启动方式
+func startContainer(containerName string, restartCount int, launch initLauncher) (int, error) {
+	var needRelease = true
+	// 记录新的容器进程和IP地址之前持有容器状态的共享锁，避免 system reconcile 杀死正在启动的容器进程、回收刚分配的IP地址
+	unlock, err := util.LockContainers(false)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	info, err := util.GetContainerInfoByName(containerName)
+	if err != nil {
+		return 0, err
+	}
 
 	// 不再使用当前路径作为容器运行的根目录，而是使用某个固定的目录+容器ID组成的目录
 	rootUrl, err := util.GetContainerRootPath(info.ID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	mntUrl := rootUrl + "mnt/"
 
-	// todo: 将envSlice放入容器信息中存储起来
-	envSlice := []string{""}
+	// mnt目录的挂载可能已经不存在了 (比如宿主机重启之后)，需要重新挂载
+	err = container.RemountWorkSpace(rootUrl, info.Image, containerName, mntUrl, info.Volume)
+	if err != nil {
+		return 0, err
+	}
 
 	// 将新建的只读层和可写层进行隔离
-	initProcess, writePipe := container.NewParentProcess(true, false, true, info.ID, containerName, info.Image, rootUrl, mntUrl, info.Volume, envSlice)
+	initProcess, writePipe := container.NewParentProcess(true, info.ID, containerName, info.Image, rootUrl, mntUrl, info.Volume)
 	if initProcess == nil || writePipe == nil {
 		fmt.Println("new parent process failed")
-		return fmt.Errorf("new parent process failed")
+		return 0, fmt.Errorf("new parent process failed")
 	}
 
-	if err := initProcess.Start(); err != nil {
+	pid, err := launch(initProcess, info)
+	if err != nil {
 		fmt.Println(fmt.Errorf("ERROR: %v", err))
-		return err
+		return 0, err
 	}
 	defer func() {
 		if needRelease {
 			// kill容器进程
-			err = syscall.Kill(initProcess.Process.Pid, syscall.SIGTERM)
+			err = syscall.Kill(pid, syscall.SIGTERM)
 			if err != nil {
 				fmt.Println(fmt.Errorf("kill container process failed, error: %v", err))
 			}
 		}
 	}()
 
-	// 将命令参数发送给容器进程
-	containerCmd := strings.Split(info.Command, " ")
-	sendInitCommand(containerCmd, writePipe)
-
-	// 向对应的资源管理器中加入新起的容器进程Pid
+	// 重新创建cgroup并设置资源限制，cgroup目录可能已经不存在了 (比如宿主机重启之后)
+	// 没有记录资源限制的容器 (旧版本创建的容器) 使用默认的资源限制
+	res := info.ResourceConfig
+	if res == nil {
+		res = config.DefaultResourceConfig()
+	}
 	cGroupPath := fmt.Sprintf(model.DefaultCgroupPath, info.ID)
 	cm := cgroups.NewCgroupManager(cGroupPath)
-	err = cm.AddProcess(initProcess.Process.Pid)
+	err = cm.Set(res)
+	if err != nil {
+		fmt.Println(fmt.Errorf("cgroup set resource-limit failed, error: %v", err))
+		return 0, err
+	}
+
+	// 向对应的资源管理器中加入新起的容器进程Pid
+	err = cm.AddProcess(pid)
 	if err != nil {
 		fmt.Println(fmt.Errorf("cgroup addProcess failed, error: %v", err))
-		return err
+		return 0, err
+	}
+
+	// 容器进程加入cgroup之后再将命令参数发送给容器进程，保证用户命令一开始运行就受到资源限制
+	initConfig, err := initConfigWithEtcFiles(rootUrl, info)
+	if err != nil {
+		fmt.Println(err)
+		return 0, err
+	}
+	err = container.SendInitConfig(writePipe, initConfig)
+	if err != nil {
+		fmt.Println(fmt.Errorf("send init config failed, error: %v", err))
+		return 0, err
 	}
 
 	// 容器的网络设置
@@ -80,10 +137,10 @@ func StartContainer(containerFlag string) error {
 		err = network.Init()
 		if err != nil {
 			fmt.Println(fmt.Errorf("network init failed, error: %v", err))
-			return err
+			return 0, err
 		} else {
 			containerInfo := &model.ContainerInfo{
-				Pid:         strconv.Itoa(initProcess.Process.Pid),
+				Pid:         strconv.Itoa(pid),
 				ID:          info.ID,
 				Name:        containerName,
 				PortMapping: info.PortMapping,
@@ -91,7 +148,13 @@ func StartContainer(containerFlag string) error {
 			ipAddress, err = network.Connect(info.NetworkName, containerInfo)
 			if err != nil {
 				fmt.Println(fmt.Errorf("network connect failed, network: %s, containerInfo: %v, error: %v", info.NetworkName, containerInfo, err))
-				return err
+				return 0, err
+			}
+			// 分配到IP地址之后在 hosts 文件中加上容器自己的主机名
+			err = container.WriteHostsFile(rootUrl, info, ipAddress)
+			if err != nil {
+				fmt.Println(err)
+				return 0, err
 			}
 		}
 	}
@@ -107,26 +170,38 @@ func StartContainer(containerFlag string) error {
 		}()
 	}
 
-	// 修改容器信息 - 主要是将新的容器进程Pid和网络IP写入容器信息文件中
-	err = updateContainerInfoForStart(info.Name, initProcess.Process.Pid, ipAddress)
+	// 修改容器信息 - 主要是将新的容器进程Pid、网络IP和资源限制写入容器信息文件中
+	err = updateContainerInfoForStart(info.Name, pid, ipAddress, res, restartCount)
 	if err != nil {
 		fmt.Println(fmt.Errorf("run: record container info failed, error: %v", err))
-		return err
+		return 0, err
 	}
 
 	needRelease = false
-	return nil
+	return pid, nil
 }
 
-func updateContainerInfoForStart(containerName string, pid int, ipAddress string) error {
+func updateContainerInfoForStart(containerName string, pid int, ipAddress string, res *subsystems.ResourceConfig, restartCount int) error {
 	info, err := util.GetContainerInfoByName(containerName)
 	if err != nil {
 		return err
 	}
 
 	info.Pid = strconv.Itoa(pid)
+	info.PidStartTime, _ = util.ProcessStartTime(pid)
 	info.IpAddress = ipAddress
 	info.Status = model.RUNNING
+	info.StartedAt = time.Now().Format("2006-01-02 15:04:05")
+	info.ResourceConfig = res
+	info.RestartCount = restartCount
+	info.ManuallyStopped = false
+	// 清除上一次运行的退出信息
+	info.OOMKilled = false
+	info.ExitCode = 0
+	info.Health = nil
+	if info.Healthcheck != nil {
+		info.Health = &model.HealthState{Status: model.HealthStarting}
+	}
 
 	infoBytes, err := json.Marshal(info)
 	if err != nil {
@@ -0,0 +1,202 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"github.com/iverson3/xdocker/cgroups"
+	"github.com/iverson3/xdocker/model"
+	"github.com/iverson3/xdocker/network"
+	"github.com/iverson3/xdocker/util"
+	"text/tabwriter"
+	"time"
+)
+
+// 统计数据的刷新间隔
+const statsInterval = time.Second
+
+// ContainerStats 容器的资源使用情况
+type ContainerStats struct {
+	ID               string  `json:"id"`
+	Name             string  `json:"name"`
+	CPUPercentage    float64 `json:"cpu_percentage"`
+	MemoryUsage      uint64  `json:"memory_usage"`
+	MemoryLimit      uint64  `json:"memory_limit"`
+	MemoryPercentage float64 `json:"memory_percentage"`
+	NetRx            uint64  `json:"net_rx"`
+	NetTx            uint64  `json:"net_tx"`
+	BlockRead        uint64  `json:"block_read"`
+	BlockWrite       uint64  `json:"block_write"`
+	Pids             uint64  `json:"pids"`
+
+	// 上一次采样时的cpu累计使用时间和采样时间，用于计算cpu使用率
+	cpuUsage   uint64
+	sampleTime time.Time
+}
+
+// StatsContainers 输出容器的资源使用情况
+// 没有指定容器时输出所有运行中的容器；noStream 为 false 时每秒刷新一次
+func StatsContainers(containerFlags []string, noStream bool, format string) error {
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+
+	infos, err := getStatsTargets(containerFlags)
+	if err != nil {
+		return err
+	}
+
+	// cpu使用率需要两次采样才能计算出来，所以先做一次采样
+	stats := make([]*ContainerStats, len(infos))
+	for i, info := range infos {
+		stats[i] = &ContainerStats{ID: info.ID, Name: info.Name}
+		if err = sampleStats(info, stats[i]); err != nil {
+			return err
+		}
+	}
+
+	for {
+		time.Sleep(statsInterval)
+		// 统计期间停止了的容器采样会失败，将其去掉，继续统计其它容器
+		runningInfos := make([]*model.ContainerInfo, 0, len(infos))
+		runningStats := make([]*ContainerStats, 0, len(stats))
+		for i, info := range infos {
+			if err = sampleStats(info, stats[i]); err != nil {
+				continue
+			}
+			runningInfos = append(runningInfos, info)
+			runningStats = append(runningStats, stats[i])
+		}
+		infos, stats = runningInfos, runningStats
+
+		if format == "json" {
+			err = printStatsJson(stats)
+		} else {
+			if !noStream {
+				// 清屏并将光标移到左上角
+				fmt.Print("\033[2J\033[H")
+			}
+			err = printStatsTable(stats)
+		}
+		if err != nil {
+			return err
+		}
+
+		if noStream {
+			return nil
+		}
+	}
+}
+
+// 获取需要统计的容器信息
+func getStatsTargets(containerFlags []string) ([]*model.ContainerInfo, error) {
+	var infos []*model.ContainerInfo
+	if len(containerFlags) == 0 {
+		dirUrl := fmt.Sprintf(model.DefaultInfoLocation, "")
+		dirUrl = dirUrl[:len(dirUrl)-1]
+
+		dirs, err := ioutil.ReadDir(dirUrl)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			info, err := util.GetContainerInfo(dir)
+			if err != nil {
+				return nil, err
+			}
+			if info.Status == model.RUNNING || info.Status == model.PAUSED {
+				infos = append(infos, info)
+			}
+		}
+		return infos, nil
+	}
+
+	for _, containerFlag := range containerFlags {
+		exists, containerName, err := util.ContainerIsExists(containerFlag)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("container not exists: %s", containerFlag)
+		}
+
+		info, err := util.GetContainerInfoByName(containerName)
+		if err != nil {
+			return nil, err
+		}
+		if info.Status != model.RUNNING && info.Status != model.PAUSED {
+			return nil, fmt.Errorf("container is not running: %s", containerFlag)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// 采样一次容器的资源使用情况，并根据上一次的采样结果计算cpu使用率
+func sampleStats(info *model.ContainerInfo, stats *ContainerStats) error {
+	cm := cgroups.NewCgroupManager(fmt.Sprintf(model.DefaultCgroupPath, info.ID))
+	cgroupStats, err := cm.GetStats()
+	if err != nil {
+		return fmt.Errorf("get stats of container %s failed, error: %v", info.Name, err)
+	}
+	now := time.Now()
+
+	// cpu使用率 = 两次采样间容器使用的cpu时间 / 两次采样间经过的时间
+	// 使用了多个cpu核时可能超过 100%
+	if !stats.sampleTime.IsZero() && cgroupStats.CPUUsage >= stats.cpuUsage {
+		elapsed := now.Sub(stats.sampleTime).Nanoseconds()
+		if elapsed > 0 {
+			stats.CPUPercentage = float64(cgroupStats.CPUUsage-stats.cpuUsage) / float64(elapsed) * 100
+		}
+	}
+	stats.cpuUsage = cgroupStats.CPUUsage
+	stats.sampleTime = now
+
+	stats.MemoryUsage = cgroupStats.MemoryUsage
+	stats.MemoryLimit = cgroupStats.MemoryLimit
+	if cgroupStats.MemoryLimit > 0 {
+		stats.MemoryPercentage = float64(cgroupStats.MemoryUsage) / float64(cgroupStats.MemoryLimit) * 100
+	}
+	stats.Pids = cgroupStats.PidsCurrent
+	stats.BlockRead = cgroupStats.BlkioRead
+	stats.BlockWrite = cgroupStats.BlkioWrite
+
+	if info.NetworkName != "" {
+		// 网络统计失败不影响其他数据的输出
+		stats.NetRx, stats.NetTx, _ = network.GetEndpointStats(info.ID, info.NetworkName)
+	}
+	return nil
+}
+
+func printStatsTable(stats []*ContainerStats) error {
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	_, _ = fmt.Fprint(w, "ID\tNAME\tCPU %\tMEM USAGE / LIMIT\tMEM %\tNET I/O\tBLOCK I/O\tPIDS\n")
+	for _, item := range stats {
+		_, _ = fmt.Fprintf(
+			w,
+			"%s\t%s\t%.2f%%\t%s / %s\t%.2f%%\t%s / %s\t%s / %s\t%d\n",
+			item.ID,
+			item.Name,
+			item.CPUPercentage,
+			util.FormatFileSize(int64(item.MemoryUsage)),
+			util.FormatFileSize(int64(item.MemoryLimit)),
+			item.MemoryPercentage,
+			util.FormatFileSize(int64(item.NetRx)),
+			util.FormatFileSize(int64(item.NetTx)),
+			util.FormatFileSize(int64(item.BlockRead)),
+			util.FormatFileSize(int64(item.BlockWrite)),
+			item.Pids)
+	}
+	return w.Flush()
+}
+
+// 每次刷新输出一行json数组，方便其他程序逐行解析
+func printStatsJson(stats []*ContainerStats) error {
+	jsonBytes, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(jsonBytes))
+	return nil
+}
@@ -1,18 +1,28 @@
 package command
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"strconv"
+	"github.com/iverson3/xdocker/cgroups"
 	"github.com/iverson3/xdocker/model"
-	"github.com/iverson3/xdocker/network"
 	"github.com/iverson3/xdocker/util"
 	"syscall"
+	"time"
+)
+
+const (
+	// 等待容器进程退出时的轮询间隔
+	stopPollInterval = 100 * time.Millisecond
+	// 发送 SIGKILL 之后等待容器的所有进程退出的最长时间
+	stopKillTimeout = 10 * time.Second
+	// 容器进程退出之后等待 shim 记录退出状态的最长时间
+	stopRecordTimeout = 3 * time.Second
 )
 
 // StopContainer 停止一个运行中的容器
-func StopContainer(container string) error {
+// 先给容器进程发送容器的 stop-signal，等待 timeout 秒 (小于0时使用容器的 stop-timeout) 之后容器进程还没有退出，
+// 则给容器 cgroup 中的所有进程发送 SIGKILL；容器的所有进程都退出之后才更新容器的状态
+func StopContainer(container string, timeout int) error {
 	exists, containerName, err := util.ContainerIsExists(container)
 	if err != nil {
 		return err
@@ -25,8 +35,14 @@ func StopContainer(container string) error {
 	if err != nil {
 		return err
 	}
+	// 等待自动重启的容器没有运行中的进程，只需要更新状态，shim 发现之后就不会再重启容器了
+	if info.Status == model.RESTARTING {
+		info.Status = model.STOP
+		info.ManuallyStopped = true
+		return util.SaveContainerInfo(info)
+	}
 	// stop只能作用于运行中的容器
-	if info.Status != model.RUNNING {
+	if info.Status != model.RUNNING && info.Status != model.PAUSED {
 		return fmt.Errorf("container not running")
 	}
 
@@ -34,45 +50,104 @@ func StopContainer(container string) error {
 	if err != nil {
 		return err
 	}
-
-	// 给容器进程发送kill信号，停止容器进程
-	err = syscall.Kill(pid, syscall.SIGTERM)
+	stopSignal := info.StopSignal
+	if stopSignal == "" {
+		stopSignal = model.DefaultStopSignal
+	}
+	sig, err := ParseSignal(stopSignal)
 	if err != nil {
 		return err
 	}
-
-	// stop  需要释放IP地址
-	// pause 不需要释放IP地址
-	// 释放当前容器的IP地址占用
-	if info.NetworkName != "" && info.IpAddress != "" {
-		if err = network.Init(); err != nil {
-			fmt.Println(fmt.Errorf("network Init() failed, error: %v", err))
-		} else {
-			err = network.ReleaseIpAddress(info.NetworkName, info.IpAddress)
-			if err != nil {
-				fmt.Println(fmt.Errorf("network ReleaseIpAddress failed, error: %v", err))
-			}
+	if timeout < 0 {
+		timeout = model.DefaultStopTimeout
+		if info.StopTimeout != nil {
+			timeout = *info.StopTimeout
 		}
 	}
 
-	// 更新存储的容器信息
-	// 更新容器的运行状态，清空容器进程的PID
-	info.Status = model.STOP
-	info.Pid = ""
-	info.IpAddress = ""
-
-	newInfoBytes, err := json.Marshal(info)
+	// 在发送信号之前记录容器是被手动停止的，shim 在容器退出之后就不会按照重启策略重启容器
+	info.ManuallyStopped = true
+	err = util.SaveContainerInfo(info)
 	if err != nil {
 		return err
 	}
 
-	// 将最新的容器信息写入对应的文件中
-	dirUrl := fmt.Sprintf(model.DefaultInfoLocation, containerName)
-	configPath := dirUrl + model.ConfigName
-	err = ioutil.WriteFile(configPath, newInfoBytes, 0622)
+	// 暂停的容器需要先解冻，否则容器进程无法处理信号
+	cm := cgroups.NewCgroupManager(fmt.Sprintf(model.DefaultCgroupPath, info.ID))
+	if info.Status == model.PAUSED {
+		if err = cm.Thaw(); err != nil {
+			return fmt.Errorf("thaw container failed, error: %v", err)
+		}
+	}
+
+	// 通过容器的 shim 进程给容器进程发送停止信号，然后等待容器进程退出
+	// 发送失败 (比如容器进程刚好已经退出了) 时直接进入强制杀死的流程
+	err = signalContainer(info, sig)
 	if err != nil {
+		fmt.Println(fmt.Errorf("send %s to container failed, error: %v", stopSignal, err))
+	} else {
+		waitProcessExit(pid, time.Duration(timeout)*time.Second)
+	}
+
+	// 超时未退出的容器进程，以及容器进程退出之后 cgroup 中残留的进程 (比如 exec 进入容器的进程) 都需要强制杀死
+	if err = killContainer(cm, pid); err != nil {
 		return err
 	}
 
-	return nil
+	// 容器的退出状态由 shim 记录 (包括释放IP地址)，这里等待它记录完成
+	return waitContainerRecorded(containerName, pid)
+}
+
+// killContainer 给容器 cgroup 中的所有进程发送 SIGKILL，并等待所有进程退出
+// pid 为容器的 init 进程，为 0 时只处理 cgroup 中的进程
+func killContainer(cm *cgroups.CgroupManager, pid int) error {
+	deadline := time.Now().Add(stopKillTimeout)
+	for {
+		pids, err := cm.Pids()
+		if err != nil {
+			return err
+		}
+		alive := pid > 0 && util.ProcessIsAlive(pid)
+		if len(pids) == 0 && !alive {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for container processes to exit")
+		}
+
+		if err = cm.SignalAll(syscall.SIGKILL); err != nil {
+			return err
+		}
+		// 容器进程没有加入cgroup (比如加入cgroup失败) 时也需要杀死
+		if alive {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+		}
+		time.Sleep(stopPollInterval)
+	}
+}
+
+// 等待进程退出，超时返回 false
+func waitProcessExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for util.ProcessIsAlive(pid) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(stopPollInterval)
+	}
+	return true
+}
+
+// 等待 shim 记录容器的退出状态
+// 前台运行的容器退出之后容器信息会被删除；没有 shim 的容器 (比如旧版本启动的容器) 则由这里记录退出状态
+func waitContainerRecorded(containerName string, pid int) error {
+	deadline := time.Now().Add(stopRecordTimeout)
+	for time.Now().Before(deadline) {
+		info, err := util.GetContainerInfoByName(containerName)
+		if err != nil || info.Pid != strconv.Itoa(pid) {
+			return nil
+		}
+		time.Sleep(stopPollInterval)
+	}
+	return recordContainerExit(containerName, pid, -1, false)
 }
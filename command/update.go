@@ -0,0 +1,54 @@
+package command
+
+import (
+	"fmt"
+	"github.com/iverson3/xdocker/cgroups"
+	"github.com/iverson3/xdocker/cgroups/subsystems"
+	"github.com/iverson3/xdocker/config"
+	"github.com/iverson3/xdocker/model"
+	"github.com/iverson3/xdocker/util"
+)
+
+// UpdateContainer 修改容器的资源限制
+// res 中只包含用户本次设置了的限制，会与容器原有的限制合并之后重新应用到容器的cgroup上，并持久化到容器信息中
+func UpdateContainer(containerFlag string, res *subsystems.ResourceConfig) error {
+	exists, containerName, err := util.ContainerIsExists(containerFlag)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("container not exists: %s", containerFlag)
+	}
+
+	info, err := util.GetContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+
+	// 没有记录资源限制的容器 (旧版本创建的容器) 以默认的资源限制为基础
+	newRes := config.DefaultResourceConfig()
+	if info.ResourceConfig != nil {
+		*newRes = *info.ResourceConfig
+	}
+	newRes.Merge(res)
+	if err = newRes.Validate(); err != nil {
+		return err
+	}
+
+	// 不管容器是否在运行都将新的限制写入cgroup中，已停止的容器再次启动时也会加入该cgroup
+	cGroupPath := fmt.Sprintf(model.DefaultCgroupPath, info.ID)
+	cm := cgroups.NewCgroupManager(cGroupPath)
+	err = cm.Set(newRes)
+	if err != nil {
+		return fmt.Errorf("update resource-limit failed, error: %v", err)
+	}
+
+	info.ResourceConfig = newRes
+	err = util.SaveContainerInfo(info)
+	if err != nil {
+		return fmt.Errorf("record container info failed, error: %v", err)
+	}
+
+	fmt.Println(containerName)
+	return nil
+}
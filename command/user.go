@@ -0,0 +1,176 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 运行容器命令的用户
+type execUser struct {
+	Uid    int
+	Gid    int
+	Groups []int // 附加组，包括主组
+}
+
+// /etc/passwd 中的一行：name:password:uid:gid:gecos:home:shell
+type passwdEntry struct {
+	Name string
+	Uid  int
+	Gid  int
+}
+
+// /etc/group 中的一行：name:password:gid:user1,user2
+type groupEntry struct {
+	Name    string
+	Gid     int
+	Members []string
+}
+
+// resolveUserFromFiles 在容器的 /etc/passwd 和 /etc/group 中解析用户，文件不存在时只能使用数字形式的 uid 和 gid
+func resolveUserFromFiles(spec string) (*execUser, error) {
+	var passwd, group io.Reader
+	if f, err := os.Open("/etc/passwd"); err == nil {
+		defer f.Close()
+		passwd = f
+	}
+	if f, err := os.Open("/etc/group"); err == nil {
+		defer f.Close()
+		group = f
+	}
+	return resolveUser(spec, passwd, group)
+}
+
+// resolveUser 解析 user[:group] 格式的用户，user 和 group 都可以是名称或者数字 (与 docker 一致)
+// 用户名必须存在于 passwd 中；数字形式的 uid 不存在于 passwd 中时，主组为 0
+// 只指定了用户时，附加组为 group 中包含该用户的所有组；指定了组时只使用这个组，不再加入用户所属的其它组 (与 runc 一致)
+func resolveUser(spec string, passwd, group io.Reader) (*execUser, error) {
+	userSpec, groupSpec := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		userSpec, groupSpec = spec[:i], spec[i+1:]
+	}
+	if userSpec == "" {
+		return nil, fmt.Errorf("invalid user: %s", spec)
+	}
+
+	passwdEntries, err := parsePasswd(passwd)
+	if err != nil {
+		return nil, err
+	}
+	groupEntries, err := parseGroup(group)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &execUser{}
+	var userName string
+	uid, uidErr := strconv.Atoi(userSpec)
+	found := false
+	for _, entry := range passwdEntries {
+		if (uidErr == nil && entry.Uid == uid) || (uidErr != nil && entry.Name == userSpec) {
+			user.Uid, user.Gid, userName = entry.Uid, entry.Gid, entry.Name
+			found = true
+			break
+		}
+	}
+	if !found {
+		if uidErr != nil {
+			return nil, fmt.Errorf("unable to find user %s: no matching entries in passwd file", userSpec)
+		}
+		if uid < 0 {
+			return nil, fmt.Errorf("invalid user: %s", spec)
+		}
+		user.Uid = uid
+	}
+
+	if groupSpec != "" {
+		gid, gidErr := strconv.Atoi(groupSpec)
+		found = false
+		for _, entry := range groupEntries {
+			if (gidErr == nil && entry.Gid == gid) || (gidErr != nil && entry.Name == groupSpec) {
+				user.Gid = entry.Gid
+				found = true
+				break
+			}
+		}
+		if !found {
+			if gidErr != nil {
+				return nil, fmt.Errorf("unable to find group %s: no matching entries in group file", groupSpec)
+			}
+			if gid < 0 {
+				return nil, fmt.Errorf("invalid group: %s", spec)
+			}
+			user.Gid = gid
+		}
+	}
+
+	user.Groups = []int{user.Gid}
+	if userName != "" && groupSpec == "" {
+		for _, entry := range groupEntries {
+			if entry.Gid == user.Gid {
+				continue
+			}
+			for _, member := range entry.Members {
+				if member == userName {
+					user.Groups = append(user.Groups, entry.Gid)
+					break
+				}
+			}
+		}
+	}
+	return user, nil
+}
+
+func parsePasswd(r io.Reader) ([]passwdEntry, error) {
+	var entries []passwdEntry
+	err := parseColonFile(r, func(fields []string) {
+		if len(fields) < 4 {
+			return
+		}
+		uid, err1 := strconv.Atoi(fields[2])
+		gid, err2 := strconv.Atoi(fields[3])
+		if err1 != nil || err2 != nil {
+			return
+		}
+		entries = append(entries, passwdEntry{Name: fields[0], Uid: uid, Gid: gid})
+	})
+	return entries, err
+}
+
+func parseGroup(r io.Reader) ([]groupEntry, error) {
+	var entries []groupEntry
+	err := parseColonFile(r, func(fields []string) {
+		if len(fields) < 3 {
+			return
+		}
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return
+		}
+		entry := groupEntry{Name: fields[0], Gid: gid}
+		if len(fields) > 3 && fields[3] != "" {
+			entry.Members = strings.Split(fields[3], ",")
+		}
+		entries = append(entries, entry)
+	})
+	return entries, err
+}
+
+// 逐行解析以冒号分隔的文件，忽略空行和注释
+func parseColonFile(r io.Reader, handle func(fields []string)) error {
+	if r == nil {
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		handle(strings.Split(line, ":"))
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,73 @@
+package command
+
+import (
+	"gotest.tools/assert"
+	"strings"
+	"testing"
+)
+
+const testPasswd = `root:x:0:0:root:/root:/bin/sh
+# comment
+nginx:x:101:101:nginx:/var/cache/nginx:/sbin/nologin
+app:x:1000:1000::/home/app:/bin/sh
+`
+
+const testGroup = `root:x:0:
+nginx:x:101:
+app:x:1000:
+audio:x:29:app,nginx
+video:x:44:app
+`
+
+func TestResolveUser(t *testing.T) {
+	resolve := func(spec string) (*execUser, error) {
+		return resolveUser(spec, strings.NewReader(testPasswd), strings.NewReader(testGroup))
+	}
+
+	user, err := resolve("app")
+	assert.NilError(t, err)
+	assert.Equal(t, 1000, user.Uid)
+	assert.Equal(t, 1000, user.Gid)
+	assert.DeepEqual(t, []int{1000, 29, 44}, user.Groups)
+
+	// 指定了组时不加入用户所属的其它组
+	user, err = resolve("nginx:video")
+	assert.NilError(t, err)
+	assert.Equal(t, 101, user.Uid)
+	assert.Equal(t, 44, user.Gid)
+	assert.DeepEqual(t, []int{44}, user.Groups)
+
+	user, err = resolve("app:app")
+	assert.NilError(t, err)
+	assert.Equal(t, 1000, user.Gid)
+	assert.DeepEqual(t, []int{1000}, user.Groups)
+
+	user, err = resolve("1000:0")
+	assert.NilError(t, err)
+	assert.Equal(t, 1000, user.Uid)
+	assert.Equal(t, 0, user.Gid)
+
+	// 不存在于 passwd 中的 uid 主组为 0
+	user, err = resolve("2000")
+	assert.NilError(t, err)
+	assert.Equal(t, 2000, user.Uid)
+	assert.Equal(t, 0, user.Gid)
+	assert.DeepEqual(t, []int{0}, user.Groups)
+
+	user, err = resolve("2000:3000")
+	assert.NilError(t, err)
+	assert.Equal(t, 3000, user.Gid)
+
+	for _, spec := range []string{"nobody", "app:staff", ":0", "-1"} {
+		_, err = resolve(spec)
+		assert.Assert(t, err != nil, spec)
+	}
+
+	// 容器中没有 passwd 和 group 文件时只能使用数字
+	user, err = resolveUser("33:33", nil, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, 33, user.Uid)
+	assert.Equal(t, 33, user.Gid)
+	_, err = resolveUser("app", nil, nil)
+	assert.Assert(t, err != nil)
+}
@@ -0,0 +1,109 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/iverson3/xdocker/model"
+	"github.com/iverson3/xdocker/util"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// 等待容器退出时检查新事件的时间间隔
+const waitInterval = 100 * time.Millisecond
+
+// WaitContainers 阻塞直到所有容器都停止运行，然后依次输出容器的退出码
+func WaitContainers(containers []string) error {
+	for _, containerFlag := range containers {
+		exitCode, err := waitContainerExit(containerFlag)
+		if err != nil {
+			return err
+		}
+		fmt.Println(exitCode)
+	}
+	return nil
+}
+
+// 等待容器停止运行并返回退出码
+// 运行中的容器在退出时都会记录 die 事件 (包含退出码)，所以等待事件日志中出现该容器的 die 事件；
+// 记录事件失败时只会输出错误，事件日志中不会有这个事件，所以同时定期检查容器信息中的状态
+func waitContainerExit(containerFlag string) (int, error) {
+	exists, containerName, err := util.ContainerIsExists(containerFlag)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("container not exists: %s", containerFlag)
+	}
+
+	// 先定位到事件日志的末尾再检查容器状态，这样两者之间容器退出也不会错过 die 事件
+	file, err := os.OpenFile(model.DefaultEventLogPath, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if _, err = file.Seek(0, io.SeekEnd); err != nil {
+		return 0, err
+	}
+
+	info, err := util.GetContainerInfoByName(containerName)
+	if err != nil {
+		return 0, err
+	}
+	// 已经停止运行的容器直接返回最近一次的退出码
+	if !waitingForExit(info) {
+		return info.ExitCode, nil
+	}
+
+	// 函数返回时关闭事件日志，读取事件的 goroutine 随之结束
+	containerId := info.ID
+	exitCh := make(chan int, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		err := readEvents(bufio.NewReader(file), true, waitInterval, func(event *model.Event) bool {
+			if event.ID != containerId || event.Action != model.EventDie {
+				return true
+			}
+			code, convErr := strconv.Atoi(event.Attributes["exitCode"])
+			if convErr != nil {
+				code = -1
+			}
+			exitCh <- code
+			return false
+		})
+		if err != nil {
+			errCh <- err
+		}
+	}()
+
+	ticker := time.NewTicker(waitInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case exitCode := <-exitCh:
+			return exitCode, nil
+		case err = <-errCh:
+			return 0, err
+		case <-ticker.C:
+		}
+
+		info, err = util.GetContainerInfoByName(containerName)
+		if err != nil {
+			// 容器信息可能正在被写入，下次再检查，容器已经被删除时才返回错误
+			if exists, _, _ := util.ContainerIsExists(containerName); !exists {
+				return 0, fmt.Errorf("container removed: %s", containerFlag)
+			}
+			continue
+		}
+		if !waitingForExit(info) {
+			return info.ExitCode, nil
+		}
+	}
+}
+
+// 容器是否还需要等待：正在等待自动重启的容器等待它重启之后的下一次退出，还没有启动过的容器等待它启动之后退出
+func waitingForExit(info *model.ContainerInfo) bool {
+	return info.Status == model.RUNNING || info.Status == model.PAUSED || info.Status == model.RESTARTING || info.Status == model.CREATED
+}
@@ -3,10 +3,12 @@ package config
 import (
 	"bufio"
 	"fmt"
+	"github.com/iverson3/xdocker/cgroups/subsystems"
 	"github.com/iverson3/xdocker/model"
 	"github.com/iverson3/xdocker/util"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -21,6 +23,15 @@ var (
 	containerNetworkSubnetKey = "container_network_subnet"
 	// ContainerNetworkSubnet 容器的网络子网网段
 	ContainerNetworkSubnet = ""
+
+	defaultPidsLimitKey = "default_pids_limit"
+	// DefaultPidsLimit 用户没有通过 -pids-limit 指定时，容器默认的最大进程数 (-1 表示不限制)
+	// 为 0 表示配置文件中没有配置
+	DefaultPidsLimit int64 = 0
+
+	defaultMemoryLimitKey = "default_memory_limit"
+	// DefaultMemoryLimit 用户没有通过 -m 指定时，容器默认的内存限制 (-1 表示不限制)
+	DefaultMemoryLimit = ""
 )
 
 // ParseConfig 解析配置文件
@@ -33,6 +44,12 @@ func ParseConfig() error {
 		if ContainerNetworkSubnet == "" {
 			ContainerNetworkSubnet = model.DefaultNetworkSubnet
 		}
+		if DefaultPidsLimit == 0 {
+			DefaultPidsLimit = model.DefaultPidsLimit
+		}
+		if DefaultMemoryLimit == "" {
+			DefaultMemoryLimit = model.DefaultMemoryLimit
+		}
 	}()
 
 	// 判断配置文件是否存在
@@ -88,6 +105,21 @@ func ParseConfig() error {
 				ImageHubServerUrl = val
 			case containerNetworkSubnetKey:
 				ContainerNetworkSubnet = val
+			case defaultPidsLimitKey:
+				limit, err := strconv.ParseInt(val, 10, 64)
+				if err != nil || limit < -1 {
+					return fmt.Errorf("invalid %s: %s", defaultPidsLimitKey, val)
+				}
+				// 资源限制中的 0 表示没有设置，配置为 0 会被悄悄替换为默认值，所以直接报错
+				if limit == 0 {
+					return fmt.Errorf("invalid %s: 0, use -1 for unlimited", defaultPidsLimitKey)
+				}
+				DefaultPidsLimit = limit
+			case defaultMemoryLimitKey:
+				if _, err := subsystems.ParseBytes(val); err != nil && val != "-1" {
+					return fmt.Errorf("invalid %s: %s", defaultMemoryLimitKey, val)
+				}
+				DefaultMemoryLimit = val
 			default:
 				// 不支持的配置key
 			}
@@ -95,3 +127,11 @@ func ParseConfig() error {
 	}
 	return nil
 }
+
+// DefaultResourceConfig 用户没有指定任何资源限制时容器使用的默认资源限制
+func DefaultResourceConfig() *subsystems.ResourceConfig {
+	return &subsystems.ResourceConfig{
+		MemoryLimit: DefaultMemoryLimit,
+		PidsLimit:   DefaultPidsLimit,
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"github.com/iverson3/xdocker/model"
+	"gotest.tools/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseConfigPidsLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xdocker-cfg")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(path string) { cfgFilePath = path }(cfgFilePath)
+	cfgFilePath = filepath.Join(dir, "xdocker.cfg")
+
+	parse := func(content string) (int64, error) {
+		assert.NilError(t, ioutil.WriteFile(cfgFilePath, []byte(content), 0644))
+		DefaultPidsLimit = 0
+		err := ParseConfig()
+		return DefaultPidsLimit, err
+	}
+
+	limit, err := parse("default_pids_limit=200\n")
+	assert.NilError(t, err)
+	assert.Equal(t, int64(200), limit)
+
+	limit, err = parse("default_pids_limit=-1\n")
+	assert.NilError(t, err)
+	assert.Equal(t, int64(-1), limit)
+
+	// 没有配置时使用默认值
+	limit, err = parse("default_memory_limit=512m\n")
+	assert.NilError(t, err)
+	assert.Equal(t, int64(model.DefaultPidsLimit), limit)
+
+	// 0 不能被默认值悄悄替换
+	for _, content := range []string{"default_pids_limit=0\n", "default_pids_limit=-2\n", "default_pids_limit=abc\n"} {
+		_, err = parse(content)
+		assert.Assert(t, err != nil, content)
+	}
+}
@@ -0,0 +1,164 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// 容器的 init 进程从 shim 继承的 console socket，用于将终端的 master 端发送给 shim
+const initConsoleSocketFd = 4
+
+// NewConsoleSocket 创建 shim 与容器 init 进程之间的 console socket (与 runc 的 console socket 一致)
+// 容器使用自己的 devpts (newinstance)，终端必须在容器中由 init 进程分配，init 进程再通过 socket 将 master 端发送给 shim
+// 返回 shim 持有的一端和交给 init 进程的一端，调用方在进程启动之后需要关闭交给 init 进程的一端
+func NewConsoleSocket(cmd *exec.Cmd) (socket, child *os.File, err error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create console socket failed, error: %v", err)
+	}
+	socket = os.NewFile(uintptr(fds[0]), "console-socket")
+	child = os.NewFile(uintptr(fds[1]), "console-socket")
+
+	// ExtraFiles[0] 是发送 InitConfig 的管道，console socket 紧随其后
+	cmd.ExtraFiles = append(cmd.ExtraFiles, child)
+	return socket, child, nil
+}
+
+// RecvConsole 在 shim 中等待容器的 init 进程发送终端的 master 端，init 进程没有发送就退出时返回错误
+// 之后容器进程 (以及容器中所有持有终端的进程) 退出时读取 master 端会得到 EIO
+func RecvConsole(socket *os.File) (*os.File, error) {
+	rawConn, err := socket.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	var n, oobn int
+	var recvErr error
+	err = rawConn.Control(func(fd uintptr) {
+		n, oobn, _, _, recvErr = syscall.Recvmsg(int(fd), buf, oob, 0)
+	})
+	if err == nil {
+		err = recvErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("receive console failed, error: %v", err)
+	}
+	if n == 0 && oobn == 0 {
+		return nil, fmt.Errorf("receive console failed, init process exited")
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		return nil, fmt.Errorf("receive console failed, invalid control message")
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		return nil, fmt.Errorf("receive console failed, invalid control message")
+	}
+	// 非阻塞模式下关闭 master 端可以打断 shim 中正在进行的读取
+	_ = syscall.SetNonblock(fds[0], true)
+	return os.NewFile(uintptr(fds[0]), "console"), nil
+}
+
+// SetUpConsole 在容器的 init 进程中 (挂载容器的 /dev/pts 之后) 为用户命令分配终端
+// slave 端作为 stdin/stdout/stderr 和控制终端，这样 Ctrl-C 等按键、作业控制和 tty 等命令才能正常工作
+// slave 端属于运行用户命令的用户 (uid)，master 端通过 console socket 发送给 shim
+func SetUpConsole(uid int) error {
+	socket := os.NewFile(initConsoleSocketFd, "console-socket")
+	defer socket.Close()
+
+	master, err := os.OpenFile("/dev/pts/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open /dev/pts/ptmx failed, error: %v", err)
+	}
+	defer master.Close()
+
+	// unlockpt 和 ptsname
+	var unlock int32
+	if err = ptyIoctl(master, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		return fmt.Errorf("unlock pty failed, error: %v", err)
+	}
+	var ptyNum uint32
+	if err = ptyIoctl(master, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&ptyNum))); err != nil {
+		return fmt.Errorf("get pty number failed, error: %v", err)
+	}
+	slavePath := fmt.Sprintf("/dev/pts/%d", ptyNum)
+	if uid != 0 {
+		if err = os.Chown(slavePath, uid, -1); err != nil {
+			return fmt.Errorf("chown %s failed, error: %v", slavePath, err)
+		}
+	}
+	slave, err := os.OpenFile(slavePath, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return fmt.Errorf("open pty slave failed, error: %v", err)
+	}
+	defer slave.Close()
+
+	// 新建会话并将 slave 端设置为控制终端
+	if _, err = syscall.Setsid(); err != nil {
+		return fmt.Errorf("setsid failed, error: %v", err)
+	}
+	slaveFd := int(slave.Fd())
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(slaveFd), syscall.TIOCSCTTY, 0); errno != 0 {
+		return fmt.Errorf("set controlling terminal failed, error: %v", errno)
+	}
+	for fd := 0; fd <= 2; fd++ {
+		if err = syscall.Dup3(slaveFd, fd, 0); err != nil {
+			return fmt.Errorf("dup pty slave failed, error: %v", err)
+		}
+	}
+
+	if err = sendConsole(socket, master); err != nil {
+		return fmt.Errorf("send console failed, error: %v", err)
+	}
+	return nil
+}
+
+// 通过 SCM_RIGHTS 发送 master 端的文件描述符，同时发送一个字节的数据 (stream socket 不能只发送控制消息)
+func sendConsole(socket, master *os.File) error {
+	socketConn, err := socket.SyscallConn()
+	if err != nil {
+		return err
+	}
+	masterConn, err := master.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sendErr error
+	err = masterConn.Control(func(masterFd uintptr) {
+		oob := syscall.UnixRights(int(masterFd))
+		err := socketConn.Control(func(fd uintptr) {
+			sendErr = syscall.Sendmsg(int(fd), []byte{0}, oob, nil, 0)
+		})
+		if err != nil {
+			sendErr = err
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// 不使用 Fd()，它会将 master 端切换为阻塞模式
+func ptyIoctl(f *os.File, req, arg uintptr) error {
+	rawConn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = rawConn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg)
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package container
+
+import (
+	"gotest.tools/assert"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestRecvConsole(t *testing.T) {
+	cmd := exec.Command("true")
+	socket, child, err := NewConsoleSocket(cmd)
+	assert.NilError(t, err)
+	defer socket.Close()
+	assert.Equal(t, child, cmd.ExtraFiles[0])
+
+	// 用管道代替终端的 master 端，收到的文件描述符与发送的指向同一个文件
+	r, w, err := os.Pipe()
+	assert.NilError(t, err)
+	defer r.Close()
+	assert.NilError(t, sendConsole(child, w))
+	w.Close()
+
+	console, err := RecvConsole(socket)
+	assert.NilError(t, err)
+	_, err = console.Write([]byte("hello"))
+	assert.NilError(t, err)
+	console.Close()
+	data, err := ioutil.ReadAll(r)
+	assert.NilError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// init 进程没有发送终端就退出了
+	child.Close()
+	_, err = RecvConsole(socket)
+	assert.Assert(t, err != nil)
+}
@@ -0,0 +1,221 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/iverson3/xdocker/model"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	hostResolvConf = "/etc/resolv.conf"
+	// 符号链接的最大解析次数 (与内核的 MAXSYMLINKS 一致)
+	maxSymlinks = 40
+)
+
+// 容器专属的 etc 文件，生成在容器根目录下，绑定挂载到容器的 /etc 目录中
+var etcFiles = []string{"hostname", "hosts", "resolv.conf"}
+
+// 宿主机只配置了本地的DNS服务器 (比如 systemd-resolved 的 127.0.0.53) 时，容器在自己的网络命名空间中访问不到，使用公共DNS服务器 (与 docker 一致)
+var defaultNameservers = []string{"8.8.8.8", "8.8.4.4"}
+
+// SetUpEtcFiles 在容器根目录下生成容器专属的 hostname、hosts 和 resolv.conf 文件
+// 返回这些文件到容器中对应路径的绑定挂载，由容器的 init 进程挂载，不会修改镜像层和容器的读写层
+// 此时还没有为容器分配IP地址，分配之后通过 WriteHostsFile 更新 hosts 文件
+func SetUpEtcFiles(rootUrl string, info *model.ContainerInfo) ([]model.MountConfig, error) {
+	err := ioutil.WriteFile(rootUrl+"hostname", []byte(info.Hostname+"\n"), 0644)
+	if err != nil {
+		return nil, fmt.Errorf("write hostname file failed, error: %v", err)
+	}
+	if err = WriteHostsFile(rootUrl, info, ""); err != nil {
+		return nil, err
+	}
+
+	var hostResolv []byte
+	if len(info.Dns) == 0 || len(info.DnsSearch) == 0 {
+		hostResolv, err = ioutil.ReadFile(hostResolvConf)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("read %s failed, error: %v", hostResolvConf, err)
+		}
+	}
+	resolv, err := buildResolvConf(bytes.NewReader(hostResolv), info.Dns, info.DnsSearch)
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(rootUrl+"resolv.conf", resolv, 0644); err != nil {
+		return nil, fmt.Errorf("write resolv.conf file failed, error: %v", err)
+	}
+
+	mounts := make([]model.MountConfig, 0, len(etcFiles))
+	for _, name := range etcFiles {
+		mounts = append(mounts, model.MountConfig{Source: rootUrl + name, Destination: "/etc/" + name})
+	}
+	return mounts, nil
+}
+
+// EtcFilePlaceholders 返回 init 进程为绑定挂载 etc 文件而在读写层中创建的占位文件 (相对于容器根目录，以 "./" 开头)
+// 镜像中没有这些文件时 init 进程会创建空的占位文件作为挂载点，提交或者导出容器时需要排除它们，否则镜像中会多出空的 etc 文件
+func EtcFilePlaceholders(rootUrl, imageName string) []string {
+	if strings.Contains(imageName, "@") {
+		imageName = strings.Split(imageName, "@")[0]
+	}
+	mntUrl := rootUrl + "mnt"
+	imageLayerPath := rootUrl + imageName
+	containerLayerPath := rootUrl + WriteLayerName
+
+	var placeholders []string
+	for _, name := range etcFiles {
+		target, err := ResolveInRoot(mntUrl, "/etc/"+name)
+		if err != nil {
+			continue
+		}
+		relPath := strings.TrimPrefix(target, mntUrl)
+		// 只存在于读写层中的空文件
+		fi, err := os.Lstat(containerLayerPath + relPath)
+		if err != nil || !fi.Mode().IsRegular() || fi.Size() != 0 {
+			continue
+		}
+		if _, err = os.Lstat(imageLayerPath + relPath); err == nil {
+			continue
+		}
+		placeholders = append(placeholders, "."+relPath)
+	}
+	return placeholders
+}
+
+// ResolveInRoot 在 root 目录下解析容器中的路径 path，返回宿主机上的路径
+// 路径中的符号链接按容器中的路径解析 (绝对路径的链接相对于 root)，结果不会超出 root；不存在的部分原样拼接在后面
+func ResolveInRoot(root, path string) (string, error) {
+	root = filepath.Clean(root)
+	current := "/"
+	pending := strings.Split(path, "/")
+	links := 0
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if name == "" || name == "." {
+			continue
+		}
+		if name == ".." {
+			current = filepath.Dir(current)
+			continue
+		}
+
+		next := filepath.Join(current, name)
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if os.IsNotExist(err) {
+			current = filepath.Join(next, strings.Join(pending, "/"))
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("too many levels of symbolic links: %s", path)
+		}
+		link, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(link) {
+			current = "/"
+		}
+		pending = append(strings.Split(link, "/"), pending...)
+	}
+	return filepath.Join(root, current), nil
+}
+
+// WriteHostsFile 生成容器的 hosts 文件，ipAddress 不为空时加上容器自己的主机名解析
+// 文件已经被绑定挂载到容器中，所以必须原地改写而不能替换成新文件
+func WriteHostsFile(rootUrl string, info *model.ContainerInfo, ipAddress string) error {
+	err := ioutil.WriteFile(rootUrl+"hosts", buildHosts(info.Hostname, ipAddress, info.ExtraHosts), 0644)
+	if err != nil {
+		return fmt.Errorf("write hosts file failed, error: %v", err)
+	}
+	return nil
+}
+
+func buildHosts(hostname, ipAddress string, extraHosts []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("127.0.0.1\tlocalhost\n")
+	buf.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+	if ipAddress != "" && hostname != "" {
+		fmt.Fprintf(&buf, "%s\t%s\n", ipAddress, hostname)
+	}
+	for _, extraHost := range extraHosts {
+		// 格式为 host:ip，ip 可能是包含冒号的 IPv6 地址
+		kv := strings.SplitN(extraHost, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s\t%s\n", kv[1], kv[0])
+	}
+	return buf.Bytes()
+}
+
+// buildResolvConf 以宿主机的 resolv.conf 为基础生成容器的 resolv.conf
+// 用户指定了 dns 或 dnsSearch 时替换宿主机对应的配置，其余配置 (比如 options) 保持不变
+// 宿主机的本地DNS服务器在容器中访问不到，会被去掉
+func buildResolvConf(hostResolv io.Reader, dns, dnsSearch []string) ([]byte, error) {
+	var nameservers, search, others []string
+	scanner := bufio.NewScanner(hostResolv)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			if len(fields) > 1 && !isLocalhost(fields[1]) {
+				nameservers = append(nameservers, fields[1])
+			}
+		case "search", "domain":
+			// domain 与 search 同时存在时以最后出现的为准
+			search = fields[1:]
+		default:
+			others = append(others, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read host resolv.conf failed, error: %v", err)
+	}
+
+	if len(dns) > 0 {
+		nameservers = dns
+	} else if len(nameservers) == 0 {
+		nameservers = defaultNameservers
+	}
+	if len(dnsSearch) > 0 {
+		search = dnsSearch
+	}
+
+	var buf bytes.Buffer
+	for _, nameserver := range nameservers {
+		fmt.Fprintf(&buf, "nameserver %s\n", nameserver)
+	}
+	if len(search) > 0 {
+		fmt.Fprintf(&buf, "search %s\n", strings.Join(search, " "))
+	}
+	for _, line := range others {
+		buf.WriteString(line + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+func isLocalhost(address string) bool {
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,88 @@
+package container
+
+import (
+	"gotest.tools/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHostResolv = `# Generated by NetworkManager
+nameserver 127.0.0.53
+nameserver 10.0.0.2
+search example.com
+options edns0 trust-ad
+`
+
+func TestBuildResolvConf(t *testing.T) {
+	resolv, err := buildResolvConf(strings.NewReader(testHostResolv), nil, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, "nameserver 10.0.0.2\nsearch example.com\noptions edns0 trust-ad\n", string(resolv))
+
+	resolv, err = buildResolvConf(strings.NewReader(testHostResolv), []string{"1.1.1.1"}, []string{"a.local", "b.local"})
+	assert.NilError(t, err)
+	assert.Equal(t, "nameserver 1.1.1.1\nsearch a.local b.local\noptions edns0 trust-ad\n", string(resolv))
+
+	// 宿主机只有本地DNS服务器时使用默认的公共DNS服务器
+	resolv, err = buildResolvConf(strings.NewReader("nameserver 127.0.0.53\nnameserver ::1\n"), nil, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, "nameserver 8.8.8.8\nnameserver 8.8.4.4\n", string(resolv))
+}
+
+func TestBuildHosts(t *testing.T) {
+	hosts := buildHosts("web", "", []string{"db:10.0.0.5", "v6:fe80::1"})
+	assert.Equal(t, "127.0.0.1\tlocalhost\n::1\tlocalhost ip6-localhost ip6-loopback\n10.0.0.5\tdb\nfe80::1\tv6\n", string(hosts))
+
+	hosts = buildHosts("web", "192.168.10.2", nil)
+	assert.Assert(t, strings.HasSuffix(string(hosts), "192.168.10.2\tweb\n"))
+}
+
+func TestResolveInRoot(t *testing.T) {
+	root := t.TempDir()
+	assert.NilError(t, os.MkdirAll(filepath.Join(root, "etc"), 0755))
+	assert.NilError(t, os.MkdirAll(filepath.Join(root, "run/resolve"), 0755))
+	assert.NilError(t, os.Symlink("/run/resolve/stub-resolv.conf", filepath.Join(root, "etc/resolv.conf")))
+	assert.NilError(t, os.Symlink("../../../../run", filepath.Join(root, "etc/run")))
+	assert.NilError(t, os.Symlink("loop", filepath.Join(root, "etc/loop")))
+
+	cases := map[string]string{
+		"/etc/hosts":             "/etc/hosts",
+		"/etc/resolv.conf":       "/run/resolve/stub-resolv.conf",
+		"/etc/run/resolve/a":     "/run/resolve/a",
+		"/../../etc/hostname":    "/etc/hostname",
+		"/missing/dir/../file":   "/missing/file",
+		"etc/../etc/resolv.conf": "/run/resolve/stub-resolv.conf",
+	}
+	for path, expected := range cases {
+		resolved, err := ResolveInRoot(root, path)
+		assert.NilError(t, err, path)
+		assert.Equal(t, filepath.Join(root, expected), resolved, path)
+	}
+
+	_, err := ResolveInRoot(root, "/etc/loop")
+	assert.Assert(t, err != nil)
+}
+
+func TestEtcFilePlaceholders(t *testing.T) {
+	rootUrl := t.TempDir() + "/"
+	image := rootUrl + "busybox/"
+	writeLayer := rootUrl + WriteLayerName + "/"
+	mnt := rootUrl + "mnt/"
+	for _, dir := range []string{image + "etc", writeLayer + "etc", writeLayer + "run", mnt + "etc", mnt + "run"} {
+		assert.NilError(t, os.MkdirAll(dir, 0755))
+	}
+	// 镜像中有 hosts，resolv.conf 是指向不存在的文件的符号链接，没有 hostname
+	assert.NilError(t, ioutil.WriteFile(image+"etc/hosts", []byte("127.0.0.1 localhost\n"), 0644))
+	assert.NilError(t, ioutil.WriteFile(mnt+"etc/hosts", []byte("127.0.0.1 localhost\n"), 0644))
+	assert.NilError(t, os.Symlink("/run/stub-resolv.conf", image+"etc/resolv.conf"))
+	assert.NilError(t, os.Symlink("/run/stub-resolv.conf", mnt+"etc/resolv.conf"))
+	// 模拟联合挂载：init 进程创建的占位文件同时出现在读写层和 mnt 中
+	for _, path := range []string{"etc/hostname", "run/stub-resolv.conf"} {
+		assert.NilError(t, ioutil.WriteFile(writeLayer+path, nil, 0644))
+		assert.NilError(t, ioutil.WriteFile(mnt+path, nil, 0644))
+	}
+
+	assert.DeepEqual(t, []string{"./etc/hostname", "./run/stub-resolv.conf"}, EtcFilePlaceholders(rootUrl, "busybox@latest"))
+}
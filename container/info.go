@@ -4,38 +4,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"strconv"
-	"strings"
 	"github.com/iverson3/xdocker/model"
 	"github.com/iverson3/xdocker/util"
 	"time"
 )
 
 
-func RecordContainerInfo(pid int, cmdArr []string, id, containerName, imageName, volume, networkName, ipAddress string, portMapping []string) error {
-	createTime := time.Now().Format("2006-01-02 15:04:05")
-	containerCmd := strings.Join(cmdArr, " ")
-
-	containerInfo := &model.ContainerInfo{
-		Pid:        strconv.Itoa(pid),
-		ID:         id,
-		Name:       containerName,
-		Image:      imageName,
-		Command:    containerCmd,
-		Volume:     volume,
-		CreateTime: createTime,
-		Status:     model.RUNNING,
-		NetworkName: networkName,
-		IpAddress: ipAddress,
-		PortMapping: portMapping,
-	}
+// RecordContainerInfo 创建容器信息目录并写入容器信息，同时记录容器的创建时间
+func RecordContainerInfo(containerInfo *model.ContainerInfo) error {
+	containerInfo.CreateTime = time.Now().Format("2006-01-02 15:04:05")
 
 	jsonBytes, err := json.Marshal(containerInfo)
 	if err != nil {
 		return fmt.Errorf("recordContainerInfo: container info to json string failed, error: %v", err)
 	}
 
-	dirUrl := fmt.Sprintf(model.DefaultInfoLocation, containerName)
+	dirUrl := fmt.Sprintf(model.DefaultInfoLocation, containerInfo.Name)
 	if err = os.MkdirAll(dirUrl, 0666); err != nil {
 		return fmt.Errorf("recordContainerInfo: mkdir %s failed, error: %v", dirUrl, err)
 	}
@@ -1,13 +1,18 @@
 package container
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/iverson3/xdocker/model"
 	"os"
 	"os/exec"
 	"syscall"
 )
 
-func NewParentProcess(isStart, tty, detach bool, containerId, containerName, imageName, rootUrl, mntUrl, volume string, envSlice []string) (*exec.Cmd, *os.File) {
+// NewParentProcess 创建容器的 init 进程 (尚未启动) 和用于发送 InitConfig 的管道的 write 端
+// init 进程启动之后会一直等待，直到通过 SendInitConfig 收到用户命令及其环境变量等配置
+// 容器的输出写入日志文件，使用终端的容器则由 init 进程在容器中分配终端，shim 将终端的输出写入日志文件
+func NewParentProcess(isStart bool, containerId, containerName, imageName, rootUrl, mntUrl, volume string) (*exec.Cmd, *os.File) {
 	// 管道原理和 channel 很像，read 端和 write 端会在另一边没有响应的时候堵塞。
 	// 使用 os.Pipe() 获取管道。返回的 readPipe 和 writePipe 都是 *os.File 类型。
 	readPipe, writePipe, err := os.Pipe()
@@ -16,35 +21,13 @@ func NewParentProcess(isStart, tty, detach bool, containerId, containerName, ima
 		return nil, nil
 	}
 
-	// 再次调用自身，第一个命令行参数是 init
-	cmd := exec.Command("/proc/self/exe", "init")
+	cmd := newInitCommand()
 
-	// 命名空间
-	// UTS  隔离nodeName和domainName (UTS Namespace)
-	// PID  隔离进程 (PID Namespace)
-	// IPC  隔离System V IPC和POSIX message queues (IPC Namespace)
-	// NET  隔离网络 (Network Namespace)
-	// NS   隔离文件系统 (Mount Namespace)
-	// USER 隔离用户组ID (User Namespace)
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWNET,
-		// todo: xxx
-		//Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWNET | syscall.CLONE_NEWUSER,
-	}
-
-	// 如果设置了交互，就把输出都导入到标准输入输出中 (如果-d后台运行，则输出不能使用标准输出)
-	if !detach && tty {
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	} else {
-		// 否则可以将输出写入日志文件中
-		logFile, err := CreateLogFile(containerName)
-		if err == nil {
-			//cmd.Stdin = os.Stdin
-			cmd.Stdout = logFile
-			cmd.Stderr = logFile
-		}
+	// 将输出写入日志文件中
+	logFile, err := CreateLogFile(containerName)
+	if err == nil {
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
 	}
 
 	// 通过环境变量将容器相关信息传递给即将启动的容器进程
@@ -69,11 +52,53 @@ func NewParentProcess(isStart, tty, detach bool, containerId, containerName, ima
 
 	// 设置进程启动的路径，将mnt目录作为容器的启动目录
 	cmd.Dir = mntUrl
-	// 环境变量设置，将用户设置的环境变量append进去
-	cmd.Env = append(os.Environ(), envSlice...)
 
 	// 把 read 端传给容器进程，然后 write 端保留在父进程中
 	return cmd, writePipe
 }
 
+// 创建容器的 init 进程对应的命令，容器进程运行在新的 namespace 中
+func newInitCommand() *exec.Cmd {
+	// 再次调用自身，第一个命令行参数是 init
+	cmd := exec.Command("/proc/self/exe", "init")
+
+	// 命名空间
+	// UTS  隔离nodeName和domainName (UTS Namespace)
+	// PID  隔离进程 (PID Namespace)
+	// IPC  隔离System V IPC和POSIX message queues (IPC Namespace)
+	// NET  隔离网络 (Network Namespace)
+	// NS   隔离文件系统 (Mount Namespace)
+	// USER 隔离用户组ID (User Namespace)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWNET,
+		// todo: xxx
+		//Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWNET | syscall.CLONE_NEWUSER,
+	}
+	return cmd
+}
+
+// SendInitConfig 将配置发送给容器的 init 进程并关闭管道，init 进程读到 EOF 之后继续运行
+// 使用 json 传递，用户命令的参数中可以包含空格、引号等任意字符
+func SendInitConfig(writePipe *os.File, config *model.InitConfig) error {
+	defer writePipe.Close()
+	return json.NewEncoder(writePipe).Encode(config)
+}
 
+// ReadInitConfig 在容器的 init 进程中读取 xdocker 发送过来的配置
+func ReadInitConfig() (*model.InitConfig, error) {
+	// 对于标准输入、输出、错误,在创建子进程的时候都是默认带着的/继承的, 所以前三个文件描述符就是这三个
+	// 第四个(下标3)则是我们的传过来的用来传递配置的管道
+	pipe := os.NewFile(uintptr(3), "pipe")
+	defer pipe.Close()
+
+	// 实际运行中，当进程运行到这里的时候会堵塞，直到 write 端传数据进来。
+	// 不用担心我们在容器运行后再传输参数。因为在读取完配置之前，init 函数也不会运行到 syscall.Exec 这一步
+	config := new(model.InitConfig)
+	if err := json.NewDecoder(pipe).Decode(config); err != nil {
+		return nil, fmt.Errorf("read init config failed, error: %v", err)
+	}
+	if len(config.Args) == 0 {
+		return nil, fmt.Errorf("init config has no command")
+	}
+	return config, nil
+}
@@ -0,0 +1,178 @@
+package container
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// shim 进程从 xdocker 继承的文件描述符
+const (
+	shimInitPipeFd = 3 // 容器 init 进程读取命令参数的管道的 read 端
+	shimLogFd      = 4 // 容器的日志文件
+	shimStatusFd   = 5 // shim 通过它将容器进程的pid或者启动失败的原因告诉 xdocker
+	shimReadyFd    = 6 // xdocker 关闭它的 write 端表示容器的启动流程已经结束
+)
+
+// shim 启动容器进程的结果
+type shimStatus struct {
+	Pid   int    `json:"pid"`
+	Error string `json:"error,omitempty"`
+}
+
+// Shim xdocker 中启动的容器 shim 进程
+type Shim struct {
+	Process *os.Process
+	InitPid int
+	ready   *os.File
+}
+
+// StartShim 启动容器的 shim 进程，再由 shim 进程启动 initProcess (由 NewParentProcess 创建但尚未启动)
+// 这样容器的 init 进程就是 shim 的子进程，xdocker 退出之后 shim 依然可以等待容器进程退出并记录退出状态
+// tty 为 true 时 shim 持有容器终端的 master 端 (由 init 进程在容器中分配之后发送给 shim)，之后可以通过 attach 连接到容器的终端
+// 调用方在完成 cgroup、网络、容器信息等设置之后 (或者回滚之后) 需要调用 Ready
+func StartShim(containerName string, initProcess *exec.Cmd, tty bool) (*Shim, error) {
+	statusRead, statusWrite, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer statusRead.Close()
+	readyRead, readyWrite, err := os.Pipe()
+	if err != nil {
+		statusWrite.Close()
+		return nil, err
+	}
+
+	logFile, ok := initProcess.Stdout.(*os.File)
+	if !ok {
+		logFile, err = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			statusWrite.Close()
+			readyRead.Close()
+			readyWrite.Close()
+			return nil, err
+		}
+	}
+	initPipe := initProcess.ExtraFiles[0]
+
+	cmd := exec.Command("/proc/self/exe", "shim", containerName)
+	if tty {
+		cmd = exec.Command("/proc/self/exe", "shim", "-tty", containerName)
+	}
+	// shim 脱离当前终端独立运行，工作目录和环境变量就是容器 init 进程的工作目录和环境变量
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
+	cmd.Dir = initProcess.Dir
+	cmd.Env = initProcess.Env
+	cmd.ExtraFiles = []*os.File{initPipe, logFile, statusWrite, readyRead}
+	err = cmd.Start()
+
+	// 这些文件已经被 shim 继承了，当前进程中的副本需要关闭，否则 shim 退出时读取状态无法得到EOF
+	initPipe.Close()
+	logFile.Close()
+	statusWrite.Close()
+	readyRead.Close()
+	if err != nil {
+		readyWrite.Close()
+		return nil, err
+	}
+
+	var status shimStatus
+	err = json.NewDecoder(statusRead).Decode(&status)
+	if err == nil && status.Error != "" {
+		err = errors.New(status.Error)
+	}
+	if err != nil {
+		readyWrite.Close()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("shim start container process failed, error: %v", err)
+	}
+
+	return &Shim{
+		Process: cmd.Process,
+		InitPid: status.Pid,
+		ready:   readyWrite,
+	}, nil
+}
+
+// Ready 通知 shim 容器的启动流程已经结束，shim 在此之后才会记录容器的退出状态
+func (s *Shim) Ready() {
+	s.ready.Close()
+	_ = s.Process.Release()
+}
+
+// ShimInit shim 进程中由 xdocker 交给它启动的容器 init 进程
+type ShimInit struct {
+	Cmd           *exec.Cmd
+	ConsoleSocket *os.File // 接收容器终端 master 端的 console socket，没有分配终端时为 nil
+	Log           *os.File
+	consoleChild  *os.File
+	status        *os.File
+	ready         *os.File
+}
+
+// NewShimInit 在 shim 进程中根据继承的文件描述符重新创建容器的 init 进程
+// tty 为 true 时 init 进程在容器中分配终端，并通过 ConsoleSocket 将 master 端发送给 shim
+func NewShimInit(tty bool) (*ShimInit, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ShimInit{
+		Log:    os.NewFile(shimLogFd, "log"),
+		status: os.NewFile(shimStatusFd, "status"),
+		ready:  os.NewFile(shimReadyFd, "ready"),
+	}
+	s.Cmd = newInitCommand()
+	s.Cmd.Stdout = s.Log
+	s.Cmd.Stderr = s.Log
+	s.Cmd.ExtraFiles = []*os.File{os.NewFile(shimInitPipeFd, "init-pipe")}
+	s.Cmd.Dir = dir
+	s.Cmd.Env = os.Environ()
+	if tty {
+		// 分配终端之前 init 进程的输出依然写入日志文件，之后由 shim 从终端的 master 端读取并写入日志文件
+		if s.ConsoleSocket, s.consoleChild, err = NewConsoleSocket(s.Cmd); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Start 启动容器的 init 进程，并将结果告诉 xdocker
+// 启动之后 shim 切换到根目录，避免占用容器的 mnt 目录导致删除容器时无法取消挂载
+func (s *ShimInit) Start() error {
+	err := s.Cmd.Start()
+	s.Cmd.ExtraFiles[0].Close()
+	if s.consoleChild != nil {
+		s.consoleChild.Close()
+	}
+
+	var status shimStatus
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Pid = s.Cmd.Process.Pid
+		_ = os.Chdir("/")
+	}
+	_ = json.NewEncoder(s.status).Encode(&status)
+	s.status.Close()
+	return err
+}
+
+// WaitReady 等待 xdocker 完成容器的启动流程 (xdocker 关闭 write 端或者退出时读到EOF)
+func (s *ShimInit) WaitReady() {
+	_, _ = io.Copy(ioutil.Discard, s.ready)
+	s.ready.Close()
+}
+
+// CloseLog 容器进程退出之后关闭 shim 持有的日志文件
+func (s *ShimInit) CloseLog() {
+	s.Log.Close()
+}
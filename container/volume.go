@@ -50,6 +50,31 @@ func NewWorkSpace(rootUrl, imageName, containerName, mntUrl, volume string) erro
 	return nil
 }
 
+// RemountWorkSpace 重新挂载已有的容器工作空间
+// 宿主机重启之后容器的只读层和读写层都还在，但mnt目录的联合挂载和数据卷的挂载都已经不存在了，启动容器之前需要重新挂载
+func RemountWorkSpace(rootUrl, imageName, containerName, mntUrl, volume string) error {
+	mounted, err := util.IsMountPoint(mntUrl)
+	if err != nil || mounted {
+		return err
+	}
+
+	err = CreateMountPoint(rootUrl, imageName, mntUrl, containerName)
+	if err != nil {
+		return err
+	}
+	if volume != "" {
+		volumeUrls, err := volumeUrlExtract(volume)
+		if err != nil {
+			return err
+		}
+		err = MountVolume(mntUrl, volumeUrls)
+		if err != nil {
+			return fmt.Errorf("RemountWorkSpace: mount volume failed, error: %v", err)
+		}
+	}
+	return nil
+}
+
 func MountVolume(mntUrl string, volumeUrls []string) error {
 	// 创建宿主机文件目录
 	parentUrl, containerUrl := volumeUrls[0], filepath.Join(mntUrl, volumeUrls[1])
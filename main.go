@@ -36,7 +36,9 @@ func main() {
 		Description: "时值 golang 战国年代，冉冉升起的一颗巨星，其名为 XDocker",
 		Commands: []cli.Command{
 			initCommand,
+			shimCommand,
 			runCommand,
+			createCommand,
 			commitCommand,
 			listRemoteImageCommand,
 			searchCommand,
@@ -48,16 +50,24 @@ func main() {
 			removeImageCommand,
 			buildCommand,
 			psCommand,
+			statsCommand,
+			updateCommand,
 			inspectCommand,
 			logCommand,
+			eventsCommand,
 			execCommand,
+			attachCommand,
 			pauseCommand,
 			continueCommand,
 			stopCommand,
+			killCommand,
+			waitCommand,
 			startCommand,
 			restartCommand,
+			restoreCommand,
 			removeCommand,
 			networkCommand,
+			systemCommand,
 			testCommand,
 		},
 	}
@@ -1,5 +1,10 @@
 package model
 
+import (
+	"github.com/iverson3/xdocker/cgroups/subsystems"
+	"time"
+)
+
 const (
 	// DefaultNetworkName 默认的网络名
 	DefaultNetworkName = "xdocker0"
@@ -7,12 +12,35 @@ const (
 	DefaultNetworkDriver = "bridge"
 	// DefaultNetworkSubnet 默认的网络子网
 	DefaultNetworkSubnet = "192.168.10.1/24"
+	// DefaultPidsLimit 容器默认的最大进程数
+	DefaultPidsLimit = 4096
+	// DefaultMemoryLimit 容器默认的内存限制
+	DefaultMemoryLimit = "512m"
+	// DefaultStopSignal 停止容器时默认发送给容器进程的信号
+	DefaultStopSignal = "SIGTERM"
+	// DefaultStopTimeout 停止容器时默认等待容器进程退出的秒数，超时之后强制杀死容器的所有进程
+	DefaultStopTimeout = 10
+	// DefaultShmSize 容器 /dev/shm 默认的大小 (字节)
+	DefaultShmSize = 64 << 20
 
 	// 容器的状态
+	CREATED = "created"
 	RUNNING = "running"
 	PAUSED = "paused"
 	STOP = "stop"
 	EXIT = "exited"
+	RESTARTING = "restarting"
+
+	// 容器的健康状态
+	HealthStarting = "starting"
+	HealthHealthy = "healthy"
+	HealthUnhealthy = "unhealthy"
+
+	// 容器的重启策略
+	RestartPolicyNo = "no"
+	RestartPolicyOnFailure = "on-failure"
+	RestartPolicyAlways = "always"
+	RestartPolicyUnlessStopped = "unless-stopped"
 
 	// DefaultInfoLocation 容器信息文件存放的默认路径 （其中 %s 代指具体的容器名）
 	DefaultInfoLocation = "/usr/xdocker/info/%s/"
@@ -32,6 +60,23 @@ const (
 	ConfigName = "config.json"
 	// ContainerLogFileName 日志文件名
 	ContainerLogFileName = "container.log"
+	// ShimSocketName 容器 shim 进程的控制socket文件名 (与容器信息文件放在同一目录下)
+	ShimSocketName = "shim.sock"
+	// DefaultEventLogPath 容器事件日志文件 (每行一个json格式的事件)
+	DefaultEventLogPath = "/usr/xdocker/events.log"
+	// DefaultLockPath 容器状态的文件锁 (见 util.LockContainers)
+	DefaultLockPath = "/usr/xdocker/xdocker.lock"
+
+	// 容器事件类型
+	EventOOM = "oom"
+	EventDie = "die"
+	EventRestart = "restart"
+	EventHealthStatus = "health_status"
+
+	// 容器 shim 进程支持的控制请求
+	ShimActionSignal = "signal"
+	ShimActionResize = "resize"
+	ShimActionAttach = "attach"
 
 	// DefaultImageHubServerUrl 默认的镜像仓库服务域名
 	DefaultImageHubServerUrl = "http://81.69.56.251:8888"
@@ -44,16 +89,105 @@ const (
 // ContainerInfo 容器信息
 type ContainerInfo struct {
 	Pid string `json:"pid"`          // 容器的init进程在宿主机上的PID
+	PidStartTime string `json:"pid_start_time"` // 容器的init进程的启动时间 (/proc/<pid>/stat 的第22个字段)，用于识别被复用的PID
 	ID string `json:"id"`            // 容器ID
 	Name string `json:"name"`        // 容器名
 	Image string `json:"image"`      // 镜像名
-	Command string `json:"command"`  // 容器运行命令
+	Command string `json:"command"`  // 容器运行命令 (用于展示)
+	Args []string `json:"args"`      // 容器运行命令及其参数，启动容器时以此为准
+	Env []string `json:"env"`        // 用户设置的环境变量
+	Init bool `json:"init"`          // 是否由 xdocker 的 init 作为容器的1号进程 (回收僵尸进程、转发信号)
+	WorkingDir string `json:"working_dir"` // 容器运行命令的工作目录，为空时为 /
+	User string `json:"user"`              // 运行容器命令的用户，为空时为 root
+	Hostname string `json:"hostname"`      // 容器的主机名
+	Dns []string `json:"dns"`              // 容器使用的DNS服务器，为空时使用宿主机的配置
+	DnsSearch []string `json:"dns_search"` // 容器使用的DNS搜索域，为空时使用宿主机的配置
+	ExtraHosts []string `json:"extra_hosts"` // 添加到容器 /etc/hosts 中的记录，格式为 host:ip
+	Tty bool `json:"tty"`                  // 是否为容器分配终端
+	ShmSize int64 `json:"shm_size"`        // 容器 /dev/shm 的大小 (字节)
 	Volume string `json:"volume"`    // 数据卷
 	CreateTime string `json:"createTime"`
 	Status string `json:"status"`    // 容器状态
 	NetworkName string `json:"network_name"`  // 网络名
 	IpAddress string `json:"ip_address"`      // 为容器分配的ip地址
 	PortMapping []string `json:"port_mapping"`// 端口映射
+	ResourceConfig *subsystems.ResourceConfig `json:"resource_config"` // 资源限制
+	OOMKilled bool `json:"oom_killed"`     // 容器最近一次运行期间是否发生过OOM
+	ExitCode int `json:"exit_code"`        // 容器最近一次退出时的退出码
+	StartedAt string `json:"started_at"`   // 容器最近一次启动的时间
+	FinishedAt string `json:"finished_at"` // 容器最近一次退出的时间
+	RestartPolicy string `json:"restart_policy"`     // 重启策略，比如 always、on-failure:3
+	RestartCount int `json:"restart_count"`          // 按照重启策略自动重启的次数
+	ManuallyStopped bool `json:"manually_stopped"`   // 容器是否是被用户手动停止的
+	StopSignal string `json:"stop_signal"`            // 停止容器时发送给容器进程的信号，为空时使用默认的 SIGTERM
+	StopTimeout *int `json:"stop_timeout"`             // 停止容器时等待容器进程退出的秒数，为空时使用默认值
+	Healthcheck *HealthConfig `json:"healthcheck"`      // 健康检查的配置，为空表示不进行健康检查
+	Health *HealthState `json:"health"`                 // 容器当前的健康状态
+}
+
+// HealthConfig 容器的健康检查配置
+type HealthConfig struct {
+	Cmd string `json:"cmd"`                       // 在容器中执行的检查命令，退出码为0表示健康
+	Interval time.Duration `json:"interval"`       // 两次检查之间的间隔
+	Timeout time.Duration `json:"timeout"`         // 单次检查的超时时间
+	StartPeriod time.Duration `json:"start_period"` // 容器启动之后的初始化时间，期间检查失败不计入失败次数
+	Retries int `json:"retries"`                   // 连续失败多少次之后认为容器不健康
+}
+
+// HealthState 容器的健康状态
+type HealthState struct {
+	Status string `json:"status"`                // starting/healthy/unhealthy
+	FailingStreak int `json:"failing_streak"`    // 连续检查失败的次数
+	Log []HealthProbe `json:"log"`             // 最近几次检查的结果
+}
+
+// HealthProbe 一次健康检查的结果
+type HealthProbe struct {
+	Start string `json:"start"`
+	End string `json:"end"`
+	ExitCode int `json:"exit_code"`
+	Output string `json:"output"`
+}
+
+// Event 容器事件
+type Event struct {
+	Time string `json:"time"`
+	Action string `json:"action"`    // 事件类型，比如 oom die
+	ID string `json:"id"`            // 容器ID
+	Name string `json:"name"`        // 容器名
+	Attributes map[string]string `json:"attributes,omitempty"` // 事件的附加信息，比如退出码
+}
+
+// ShimRequest 发送给容器 shim 进程的控制请求 (通过控制socket，每个请求一行json)
+type ShimRequest struct {
+	Action string `json:"action"`          // 请求类型，比如 signal resize
+	Signal int `json:"signal,omitempty"`    // 发送给容器进程的信号
+	Width uint16 `json:"width,omitempty"`   // 终端的列数
+	Height uint16 `json:"height,omitempty"` // 终端的行数
+}
+
+// ShimResponse 容器 shim 进程对控制请求的响应
+type ShimResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// InitConfig xdocker 通过管道发送给容器 init 进程的配置 (json)，init 进程据此准备好环境之后执行用户命令
+type InitConfig struct {
+	Args []string `json:"args"`                  // 用户命令及其参数
+	Env []string `json:"env"`                    // 用户命令的环境变量
+	Cwd string `json:"cwd,omitempty"`            // 用户命令的工作目录，为空时为 /
+	User string `json:"user,omitempty"`          // 运行用户命令的用户，格式为 uid[:gid]，为空时为 root
+	Hostname string `json:"hostname,omitempty"`  // 容器的主机名，为空时不修改
+	Init bool `json:"init,omitempty"`            // 是否由 xdocker 的 init 作为容器的1号进程，用户命令作为它的子进程运行
+	Mounts []MountConfig `json:"mounts,omitempty"` // init 进程在切换根目录之前需要绑定挂载到容器中的文件或目录
+	ShmSize int64 `json:"shm_size,omitempty"` // /dev/shm 的大小 (字节)，为 0 时使用默认大小
+	Tty bool `json:"tty,omitempty"`             // 是否在容器中为用户命令分配终端，master 端通过 console socket 发送给 shim
+}
+
+// MountConfig 绑定挂载，Source 为宿主机上的路径，Destination 为容器中的路径
+type MountConfig struct {
+	Source string `json:"source"`
+	Destination string `json:"destination"`
 }
 
 // ImageInfo 镜像信息
@@ -9,6 +9,7 @@ package namespace
 #include <stdlib.h>
 #include <string.h>
 #include <fcntl.h>
+#include <sys/wait.h>
 
 // 构造函数：这里作用是在被引用的时候，这段代码就会执行
 __attribute__((constructor)) static void enter_namespace(void) {
@@ -46,9 +47,18 @@ __attribute__((constructor)) static void enter_namespace(void) {
 		}
 		close(fd);
 	}
-    // 进入后执行指定的命令
+    // 等待父进程将当前进程加入容器的cgroup (父进程关闭管道的写端即表示完成)
+    // 之后再执行命令，这样命令及其子进程一开始就受到容器资源限制，pause 时也会被一起冻结
+	char buf;
+	while (read(3, &buf, 1) > 0) {
+	}
+	close(3);
+    // 进入后执行指定的命令，以命令的退出码退出 (被信号杀死时为 128 + 信号值)
 	int res = system(mydocker_cmd);
-	exit(0);
+	if (res != -1 && WIFSIGNALED(res)) {
+		exit(128 + WTERMSIG(res));
+	}
+	exit(res == -1 ? 127 : WEXITSTATUS(res));
 	return;
 }
 */
@@ -168,3 +168,28 @@ func (ipam *IPAM) Release(subnet *net.IPNet, ipaddr *net.IP) error {
 	// 保存释放IP后的配置信息
 	return ipam.dump()
 }
+
+// Allocated 获取网段中已经分配了的IP地址
+func (ipam *IPAM) Allocated(subnet *net.IPNet) ([]net.IP, error) {
+	ipam.Subnets = &map[string]string{}
+	err := ipam.load()
+	if err != nil {
+		return nil, fmt.Errorf("load subnet file err: %v", err)
+	}
+
+	var ips []net.IP
+	for c, bit := range (*ipam.Subnets)[subnet.String()] {
+		if bit != '1' {
+			continue
+		}
+		// 与 Allocate 中的计算方式相同，但不修改 subnet.IP
+		ip := make(net.IP, net.IPv4len)
+		copy(ip, subnet.IP.To4())
+		for t := uint(4); t > 0; t -= 1 {
+			ip[4-t] += uint8(c >> ((t - 1) * 8))
+		}
+		ip[3] += 1
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
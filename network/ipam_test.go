@@ -41,3 +41,25 @@ func TestIPAM_Allocate(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, "192.168.0.3", ip4.String())
 }
+
+func TestIPAM_Allocated(t *testing.T) {
+	_ = os.RemoveAll(model.IpamDefaultAllocatorPath)
+
+	for i := 0; i < 3; i++ {
+		_, ipNet, _ := net.ParseCIDR("192.168.0.0/24")
+		_, err := ipAllocator.Allocate(ipNet)
+		assert.Equal(t, nil, err)
+	}
+	_, ipNet, _ := net.ParseCIDR("192.168.0.0/24")
+	ip2 := net.ParseIP("192.168.0.2")
+	assert.Equal(t, nil, ipAllocator.Release(ipNet, &ip2))
+
+	// 只返回还在占用中的IP地址，并且不修改传入的网段
+	_, ipNet, _ = net.ParseCIDR("192.168.0.0/24")
+	ips, err := ipAllocator.Allocated(ipNet)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(ips))
+	assert.Equal(t, "192.168.0.1", ips[0].String())
+	assert.Equal(t, "192.168.0.3", ips[1].String())
+	assert.Equal(t, "192.168.0.0", ipNet.IP.String())
+}
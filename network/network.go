@@ -13,6 +13,8 @@ import (
 	"runtime"
 	"strings"
 	"github.com/iverson3/xdocker/model"
+	"io/ioutil"
+	"strconv"
 	"text/tabwriter"
 )
 
@@ -372,4 +374,59 @@ func ReleaseIpAddress(networkName, ipAddress string) error {
 		return fmt.Errorf("release ip address failed, error: %v", err)
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// ReleaseUnusedIpAddresses 释放各个网络中除网关和 inUse (key 为网络名) 之外的所有已分配的IP地址
+// 用于回收已经退出的容器残留的IP地址占用，返回每个网络中被释放的IP地址
+func ReleaseUnusedIpAddresses(inUse map[string][]string) (map[string][]string, error) {
+	released := map[string][]string{}
+	for name, nw := range networks {
+		used := map[string]bool{nw.GatewayIP.String(): true}
+		for _, ip := range inUse[name] {
+			used[ip] = true
+		}
+
+		_, ipNet, err := net.ParseCIDR(nw.Subnet)
+		if err != nil {
+			return released, fmt.Errorf("parse subnet of network %s failed, error: %v", name, err)
+		}
+		ips, err := ipAllocator.Allocated(ipNet)
+		if err != nil {
+			return released, err
+		}
+		for _, ip := range ips {
+			if used[ip.String()] {
+				continue
+			}
+			if err = ReleaseIpAddress(name, ip.String()); err != nil {
+				return released, err
+			}
+			released[name] = append(released[name], ip.String())
+		}
+	}
+	return released, nil
+}
+
+// GetEndpointStats 获取容器网络端点累计接收和发送的字节数
+// 读取的是宿主机一端的veth设备的统计数据，宿主机一端接收的数据就是容器发送出去的数据，所以收发需要对调
+func GetEndpointStats(containerId, networkName string) (rxBytes, txBytes uint64, err error) {
+	// veth设备名与 BridgeNetworkDriver.Connect 中的命名方式保持一致
+	endpointId := fmt.Sprintf("%s-%s", containerId, networkName)
+	statsDir := fmt.Sprintf("/sys/class/net/%s/statistics", endpointId[:5])
+
+	readCounter := func(name string) (uint64, error) {
+		content, err := ioutil.ReadFile(path.Join(statsDir, name))
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	}
+
+	if rxBytes, err = readCounter("tx_bytes"); err != nil {
+		return 0, 0, err
+	}
+	if txBytes, err = readCounter("rx_bytes"); err != nil {
+		return 0, 0, err
+	}
+	return rxBytes, txBytes, nil
+}
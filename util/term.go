@@ -0,0 +1,71 @@
+package util
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// 终端窗口大小，对应内核的 struct winsize
+type winsize struct {
+	Row    uint16
+	Col    uint16
+	Xpixel uint16
+	Ypixel uint16
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// IsTerminal 判断文件描述符是否为终端
+func IsTerminal(fd uintptr) bool {
+	var termios syscall.Termios
+	return ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&termios))) == nil
+}
+
+// MakeRaw 将终端设置为 raw 模式 (不回显、不处理特殊字符、按字节读取)，返回原来的设置用于 RestoreTerminal
+// 容器使用自己的终端，宿主机的终端需要把所有按键原样交给容器
+func MakeRaw(fd uintptr) (*syscall.Termios, error) {
+	var oldState syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&oldState))); err != nil {
+		return nil, err
+	}
+
+	// 与 cfmakeraw(3) 一致
+	newState := oldState
+	newState.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	newState.Oflag &^= syscall.OPOST
+	newState.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	newState.Cflag &^= syscall.CSIZE | syscall.PARENB
+	newState.Cflag |= syscall.CS8
+	newState.Cc[syscall.VMIN] = 1
+	newState.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(&newState))); err != nil {
+		return nil, err
+	}
+	return &oldState, nil
+}
+
+// RestoreTerminal 恢复 MakeRaw 之前的终端设置
+func RestoreTerminal(fd uintptr, state *syscall.Termios) error {
+	return ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(state)))
+}
+
+// GetWinsize 获取终端的列数和行数
+func GetWinsize(fd uintptr) (width, height uint16, err error) {
+	var ws winsize
+	if err = ioctl(fd, syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))); err != nil {
+		return 0, 0, err
+	}
+	return ws.Col, ws.Row, nil
+}
+
+// SetWinsize 设置终端的列数和行数，内核会给终端的前台进程组发送 SIGWINCH
+func SetWinsize(fd uintptr, width, height uint16) error {
+	ws := winsize{Row: height, Col: width}
+	return ioctl(fd, syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+}
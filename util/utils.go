@@ -8,12 +8,20 @@ import (
 	"io/fs"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
+// 连接容器 shim 进程的控制socket的超时时间
+const shimDialTimeout = 500 * time.Millisecond
+
 // GetContainerRootPath 获取容器的根目录
 func GetContainerRootPath(containerId string) (string, error) {
 	rootUrl := fmt.Sprintf(model.DefaultContainerRoot, containerId)
@@ -32,7 +40,17 @@ func GetContainerRootPath(containerId string) (string, error) {
 	return rootUrl, nil
 }
 
+// GetContainerInfoByName 获取容器信息，容器进程已经不存在但依然记录为运行中的容器会被记为已退出
 func GetContainerInfoByName(containerName string) (*model.ContainerInfo, error) {
+	info, err := LoadContainerInfo(containerName)
+	if err != nil {
+		return nil, err
+	}
+	return reconcileContainerInfo(info)
+}
+
+// LoadContainerInfo 读取容器信息文件中记录的容器信息，不校正容器的运行状态
+func LoadContainerInfo(containerName string) (*model.ContainerInfo, error) {
 	dirUrl := fmt.Sprintf(model.DefaultInfoLocation, containerName)
 	configPath := dirUrl + model.ConfigName
 
@@ -59,6 +77,70 @@ func GetContainerInfoByName(containerName string) (*model.ContainerInfo, error)
 	return info, nil
 }
 
+// SaveContainerInfo 将容器信息写入容器对应的 config.json 文件中
+func SaveContainerInfo(info *model.ContainerInfo) error {
+	infoBytes, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	dirUrl := fmt.Sprintf(model.DefaultInfoLocation, info.Name)
+	configPath := dirUrl + model.ConfigName
+	return ioutil.WriteFile(configPath, infoBytes, 0622)
+}
+
+// RecordEvent 将容器事件追加到事件日志文件中
+func RecordEvent(action, containerId, containerName string, attributes map[string]string) error {
+	event := &model.Event{
+		Time:       time.Now().Format("2006-01-02 15:04:05"),
+		Action:     action,
+		ID:         containerId,
+		Name:       containerName,
+		Attributes: attributes,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	// 以追加的方式打开，多个进程同时写入时每一行都是完整的
+	file, err := os.OpenFile(model.DefaultEventLogPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(eventBytes, '\n'))
+	return err
+}
+
+// LockContainers 获取容器状态的文件锁，返回释放锁的函数 (可以多次调用)
+// run/create/start 从创建容器的资源 (工作空间、cgroup、IP地址) 到记录容器信息期间持有共享锁，互不影响；
+// system reconcile 持有排它锁，等它们记录完容器信息再执行，不会把正在创建的容器的资源当作已经删除的容器的残留
+func LockContainers(exclusive bool) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(model.DefaultLockPath), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(model.DefaultLockPath, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if err = syscall.Flock(int(file.Fd()), how); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("lock %s failed, error: %v", model.DefaultLockPath, err)
+	}
+
+	// 关闭文件即释放锁
+	var once sync.Once
+	return func() {
+		once.Do(func() { file.Close() })
+	}, nil
+}
+
 func ContainerIsExistsByName(containerName string) (bool, error) {
 	// 遍历 /var/run/xdocker 便可以得到所有的容器目录，容器目录名就是容器名
 	dirUrl := fmt.Sprintf(model.DefaultInfoLocation, "")
@@ -406,6 +488,146 @@ func GetContainerIdByName(containerName string) (string, error) {
 	return containerInfo.ID, nil
 }
 
+// ProcessIsAlive 判断进程是否还在运行，已经退出但还没被回收的僵尸进程也算作已退出
+func ProcessIsAlive(pid int) bool {
+	if err := syscall.Kill(pid, 0); err != nil && err != syscall.EPERM {
+		return false
+	}
+
+	fields, err := readProcessStat(pid)
+	if err != nil {
+		return false
+	}
+	return fields[0] != "Z"
+}
+
+// ProcessStartTime 获取进程的启动时间，即 /proc/<pid>/stat 的第22个字段 (系统启动之后经过的时钟周期数)
+// 和 pid 一起记录下来就可以唯一确定一个进程，避免进程退出之后 pid 被其他进程复用而误判
+func ProcessStartTime(pid int) (string, error) {
+	fields, err := readProcessStat(pid)
+	if err != nil {
+		return "", err
+	}
+	// fields 从第3个字段 (进程状态) 开始
+	if len(fields) < 20 {
+		return "", fmt.Errorf("invalid stat of process %d", pid)
+	}
+	return fields[19], nil
+}
+
+// 读取 /proc/<pid>/stat 中进程名之后的字段
+// /proc/<pid>/stat 的格式为 "pid (comm) state ..."，comm 中可能包含空格，所以从最后一个 ')' 开始解析
+func readProcessStat(pid int) ([]string, error) {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	stat := string(content)
+	index := strings.LastIndex(stat, ")")
+	if index < 0 {
+		return nil, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	fields := strings.Fields(stat[index+1:])
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	return fields, nil
+}
+
+// ContainerProcessIsAlive 判断容器信息中记录的容器进程是否还在运行
+// 记录了进程启动时间的容器还会比较启动时间，pid 被其他进程复用时也算作已退出
+func ContainerProcessIsAlive(info *model.ContainerInfo) bool {
+	pid, err := strconv.Atoi(info.Pid)
+	if err != nil || !ProcessIsAlive(pid) {
+		return false
+	}
+	if info.PidStartTime == "" {
+		return true
+	}
+	startTime, err := ProcessStartTime(pid)
+	return err == nil && startTime == info.PidStartTime
+}
+
+// ShimSocketPath 容器 shim 进程的控制socket的路径
+func ShimSocketPath(containerName string) string {
+	return fmt.Sprintf(model.DefaultInfoLocation, containerName) + model.ShimSocketName
+}
+
+// ShimIsAlive 判断容器的 shim 进程是否还在运行 (能否连接上它的控制socket)
+func ShimIsAlive(containerName string) bool {
+	conn, err := net.DialTimeout("unix", ShimSocketPath(containerName), shimDialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// 校正容器信息中残留的运行状态
+// 容器信息中的状态只有在执行命令的时候才会改变，容器进程被直接杀死、shim 进程异常退出或者宿主机重启之后，
+// 容器信息中依然是运行状态，此时将容器记为已退出 (退出码未知)
+// 有 shim 进程的容器由 shim 负责记录退出状态，这里不做处理；IP地址等资源由 xdocker system reconcile 回收
+func reconcileContainerInfo(info *model.ContainerInfo) (*model.ContainerInfo, error) {
+	if info.Status != model.RUNNING && info.Status != model.PAUSED && info.Status != model.RESTARTING {
+		return info, nil
+	}
+	if ContainerProcessIsAlive(info) || ShimIsAlive(info.Name) {
+		return info, nil
+	}
+
+	info.Status = model.EXIT
+	if info.ManuallyStopped {
+		info.Status = model.STOP
+	}
+	info.Pid = ""
+	info.PidStartTime = ""
+	info.ExitCode = -1
+	info.FinishedAt = time.Now().Format("2006-01-02 15:04:05")
+	if err := SaveContainerInfo(info); err != nil {
+		return nil, err
+	}
+	err := RecordEvent(model.EventDie, info.ID, info.Name, map[string]string{
+		"exitCode":  "-1",
+		"oomKilled": "false",
+	})
+	if err != nil {
+		fmt.Println(fmt.Errorf("record die event failed, error: %v", err))
+	}
+	return info, nil
+}
+
+// IsMountPoint 判断路径是否是一个挂载点
+func IsMountPoint(path string) (bool, error) {
+	mountPoints, err := MountPoints()
+	if err != nil {
+		return false, err
+	}
+	path = filepath.Clean(path)
+	for _, mountPoint := range mountPoints {
+		if mountPoint == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MountPoints 获取当前 mount namespace 中的所有挂载点
+func MountPoints() ([]string, error) {
+	content, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	var mountPoints []string
+	for _, line := range strings.Split(string(content), "\n") {
+		// mountinfo 的第5个字段为挂载点
+		fields := strings.Fields(line)
+		if len(fields) > 4 {
+			mountPoints = append(mountPoints, fields[4])
+		}
+	}
+	return mountPoints, nil
+}
+
 func GetEnvsByPid(pid string) ([]string, error) {
 	// 读取正在运行的容器进程，得到其中的环境变量
 	path := fmt.Sprintf("/proc/%s/environ", pid)
@@ -426,22 +648,7 @@ func GetEnvsByPid(pid string) ([]string, error) {
 
 func GetContainerInfo(dir fs.FileInfo) (*model.ContainerInfo, error) {
 	// 目录名即为容器名
-	containerName := dir.Name()
-	configDir := fmt.Sprintf(model.DefaultInfoLocation, containerName)
-	configFilePath := configDir + model.ConfigName
-
-	content, err := ioutil.ReadFile(configFilePath)
-	if err != nil {
-		return nil, err
-	}
-
-	info := new(model.ContainerInfo)
-	err = json.Unmarshal(content, info)
-	if err != nil {
-		return nil, err
-	}
-
-	return info, nil
+	return GetContainerInfoByName(dir.Name())
 }
 
 func ImageIsExist(image string) (bool, error) {